@@ -0,0 +1,236 @@
+// Package aac parses the AudioSpecificConfig of AAC, which is carried by the sequence headers
+// of RTMP audio messages, and writes AAC frames with ADTS headers.
+package aac
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/c-bata/rtmp/internal/bits"
+)
+
+var errInvalidAudioSpecificConfig = errors.New("aac: invalid AudioSpecificConfig")
+
+// Audio object types defined in ISO/IEC 14496-3.
+const (
+	ObjectTypeMain = 1
+	ObjectTypeLC   = 2
+	ObjectTypeSSR  = 3
+	ObjectTypeLTP  = 4
+	ObjectTypeSBR  = 5
+	ObjectTypeER   = 17
+	ObjectTypeLD   = 23
+	ObjectTypePS   = 29
+	ObjectTypeELD  = 39
+)
+
+// explicitSampleRateIndex is the sampling frequency index of which the rate is written explicitly.
+const explicitSampleRateIndex = 15
+
+// SampleRates are the sampling rates of the sampling frequency indexes.
+var SampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// Sync extension types which signal SBR and PS backward-compatibly.
+const (
+	syncExtensionTypeSBR = 0x2b7
+	syncExtensionTypePS  = 0x548
+)
+
+// An AudioSpecificConfig is the configuration of AAC defined in ISO/IEC 14496-3, which is the data
+// of AAC sequence headers.
+type AudioSpecificConfig struct {
+	// ObjectType is the object type of the core codec, like LC, even if SBR or PS is used.
+	ObjectType uint8
+	// SampleRateIndex is explicitSampleRateIndex if the rate is not one of SampleRates.
+	SampleRateIndex uint8
+	SampleRate      int
+	ChannelConfig   uint8
+	// FrameLength is the number of samples in a frame, which is 1024 or 960.
+	FrameLength int
+
+	// SBR and PS report whether the spectral band replication (HE-AAC) and the parametric stereo
+	// (HE-AAC v2) are used. ExtensionSampleRate is the output sampling rate of SBR.
+	SBR                 bool
+	PS                  bool
+	ExtensionSampleRate int
+}
+
+// ProfileName returns the name of the profile, like "LC" and "HE-AAC".
+func (c *AudioSpecificConfig) ProfileName() string {
+	switch {
+	case c.PS:
+		return "HE-AAC v2"
+	case c.SBR:
+		return "HE-AAC"
+	}
+	switch c.ObjectType {
+	case ObjectTypeMain:
+		return "Main"
+	case ObjectTypeLC:
+		return "LC"
+	case ObjectTypeSSR:
+		return "SSR"
+	case ObjectTypeLTP:
+		return "LTP"
+	case ObjectTypeLD:
+		return "LD"
+	case ObjectTypeELD:
+		return "ELD"
+	}
+	return fmt.Sprintf("ObjectType(%d)", c.ObjectType)
+}
+
+// Channels returns the number of channels, or 0 if the channel configuration is in the program config element.
+func (c *AudioSpecificConfig) Channels() int {
+	switch {
+	case c.ChannelConfig >= 1 && c.ChannelConfig <= 6:
+		return int(c.ChannelConfig)
+	case c.ChannelConfig == 7:
+		return 8
+	}
+	return 0
+}
+
+// OutputSampleRate returns the sampling rate of the decoded audio, which is doubled by SBR.
+func (c *AudioSpecificConfig) OutputSampleRate() int {
+	if c.SBR && c.ExtensionSampleRate != 0 {
+		return c.ExtensionSampleRate
+	}
+	return c.SampleRate
+}
+
+// ParseAudioSpecificConfig parses the AudioSpecificConfig.
+func ParseAudioSpecificConfig(data []byte) (*AudioSpecificConfig, error) {
+	c := &AudioSpecificConfig{FrameLength: 1024}
+	if err := c.parse(bits.NewReader(data)); err != nil {
+		return nil, errInvalidAudioSpecificConfig
+	}
+	return c, nil
+}
+
+func (c *AudioSpecificConfig) parse(r *bits.Reader) error {
+	objectType, err := readObjectType(r)
+	if err != nil {
+		return err
+	}
+	if c.SampleRateIndex, c.SampleRate, err = readSampleRate(r); err != nil {
+		return err
+	}
+	channelConfig, err := r.ReadBits(4)
+	if err != nil {
+		return err
+	}
+	c.ChannelConfig = uint8(channelConfig)
+
+	// Explicit signaling of SBR and PS, in which the object type of the core codec follows.
+	if objectType == ObjectTypeSBR || objectType == ObjectTypePS {
+		c.SBR = true
+		c.PS = objectType == ObjectTypePS
+		if _, c.ExtensionSampleRate, err = readSampleRate(r); err != nil {
+			return err
+		}
+		if objectType, err = readObjectType(r); err != nil {
+			return err
+		}
+	}
+	c.ObjectType = objectType
+
+	switch c.ObjectType {
+	case ObjectTypeMain, ObjectTypeLC, ObjectTypeSSR, ObjectTypeLTP:
+	default:
+		// The rest of the other object types is not needed.
+		return nil
+	}
+	if err = c.parseGASpecificConfig(r); err != nil {
+		return err
+	}
+	// The program config element follows if the channel configuration is 0. It is not parsed,
+	// so the sync extension after it is not either.
+	if c.SBR || c.ChannelConfig == 0 {
+		return nil
+	}
+	return parseSyncExtension(r, c)
+}
+
+// parseGASpecificConfig parses the GASpecificConfig, which is the configuration of the general audio coding.
+func (c *AudioSpecificConfig) parseGASpecificConfig(r *bits.Reader) error {
+	frameLengthFlag, err := r.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if frameLengthFlag {
+		c.FrameLength = 960
+	}
+	dependsOnCoreCoder, err := r.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if dependsOnCoreCoder {
+		// coreCoderDelay
+		if err = r.Skip(14); err != nil {
+			return err
+		}
+	}
+	// extensionFlag, which is 0 for the object types of GASpecificConfig parsed here.
+	return r.Skip(1)
+}
+
+// parseSyncExtension parses the backward-compatible signaling of SBR and PS, which follows the
+// GASpecificConfig.
+func parseSyncExtension(r *bits.Reader, c *AudioSpecificConfig) error {
+	if r.Len() < 16 {
+		return nil
+	}
+	syncExtensionType, err := r.ReadBits(11)
+	if err != nil || syncExtensionType != syncExtensionTypeSBR {
+		return err
+	}
+	extensionObjectType, err := readObjectType(r)
+	if err != nil || extensionObjectType != ObjectTypeSBR {
+		return err
+	}
+	if c.SBR, err = r.ReadFlag(); err != nil || !c.SBR {
+		return err
+	}
+	if _, c.ExtensionSampleRate, err = readSampleRate(r); err != nil {
+		return err
+	}
+	if r.Len() < 12 {
+		return nil
+	}
+	if syncExtensionType, err = r.ReadBits(11); err != nil || syncExtensionType != syncExtensionTypePS {
+		return err
+	}
+	c.PS, err = r.ReadFlag()
+	return err
+}
+
+func readObjectType(r *bits.Reader) (uint8, error) {
+	objectType, err := r.ReadBits(5)
+	if err != nil {
+		return 0, err
+	}
+	if objectType == 31 {
+		ext, err := r.ReadBits(6)
+		if err != nil {
+			return 0, err
+		}
+		objectType = 32 + ext
+	}
+	return uint8(objectType), nil
+}
+
+func readSampleRate(r *bits.Reader) (uint8, int, error) {
+	index, err := r.ReadBits(4)
+	if err != nil {
+		return 0, 0, err
+	}
+	if index == explicitSampleRateIndex {
+		rate, err := r.ReadBits(24)
+		return uint8(index), int(rate), err
+	}
+	if int(index) >= len(SampleRates) {
+		return 0, 0, errInvalidAudioSpecificConfig
+	}
+	return uint8(index), SampleRates[index], nil
+}
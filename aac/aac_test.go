@@ -0,0 +1,40 @@
+package aac
+
+import "testing"
+
+func TestParseAudioSpecificConfig(t *testing.T) {
+	for _, tt := range []struct {
+		data       []byte
+		profile    string
+		sampleRate int
+		outputRate int
+		channels   int
+	}{
+		// AAC LC, 44.1 kHz, stereo
+		{[]byte{0x12, 0x10}, "LC", 44100, 44100, 2},
+		// AAC LC, 48 kHz, 5.1
+		{[]byte{0x11, 0xb0}, "LC", 48000, 48000, 6},
+		// HE-AAC with the explicit signaling, 24 kHz core, 48 kHz output, stereo
+		{[]byte{0x2b, 0x11, 0x88, 0x00}, "HE-AAC", 24000, 48000, 2},
+		// HE-AAC v2 with the explicit signaling, 24 kHz core, 48 kHz output, mono
+		{[]byte{0xeb, 0x09, 0x88, 0x00}, "HE-AAC v2", 24000, 48000, 1},
+		// HE-AAC with the backward-compatible signaling
+		{[]byte{0x13, 0x90, 0x56, 0xe5, 0xa0}, "HE-AAC", 22050, 44100, 2},
+		// AAC LC with the explicit sampling rate of 37.8 kHz
+		{[]byte{0x17, 0x80, 0x49, 0xd4, 0x10, 0x00}, "LC", 37800, 37800, 2},
+	} {
+		c, err := ParseAudioSpecificConfig(tt.data)
+		if err != nil {
+			t.Errorf("should be nil, but got %s", err)
+			continue
+		}
+		if c.ProfileName() != tt.profile || c.SampleRate != tt.sampleRate || c.OutputSampleRate() != tt.outputRate || c.Channels() != tt.channels {
+			t.Errorf("should be %s, %d Hz (output %d Hz), %d channels, but got %s, %d Hz (output %d Hz), %d channels",
+				tt.profile, tt.sampleRate, tt.outputRate, tt.channels, c.ProfileName(), c.SampleRate, c.OutputSampleRate(), c.Channels())
+		}
+	}
+
+	if _, err := ParseAudioSpecificConfig([]byte{0x12}); err == nil {
+		t.Errorf("should be error for the truncated AudioSpecificConfig")
+	}
+}
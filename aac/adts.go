@@ -0,0 +1,73 @@
+package aac
+
+import (
+	"errors"
+	"io"
+)
+
+// ADTSHeaderSize is the size of the ADTS header without CRC.
+const ADTSHeaderSize = 7
+
+// maxADTSFrameLength is the maximum length of an ADTS frame, including the header.
+const maxADTSFrameLength = 1<<13 - 1
+
+var (
+	errUnsupportedADTSObjectType = errors.New("aac: object type is not supported by ADTS")
+	errUnsupportedADTSSampleRate = errors.New("aac: explicit sampling rate is not supported by ADTS")
+	errADTSFrameTooLarge         = errors.New("aac: frame is too large for ADTS")
+)
+
+// ADTSHeader returns the ADTS header of a raw AAC frame of the size, without CRC.
+//
+//	+-----------+----+-------+-------------------+---------+--------------------------+---------+----------------+
+//	| syncword  | ID | layer | protection_absent | profile | sampling_frequency_index | private | channel_config |
+//	| (12 bits) | (1)| (2)   | (1)               | (2)     | (4)                      | (1)     | (3)            |
+//	+-----------+----+-------+-------------------+---------+--------------------------+---------+----------------+
+//	| original/copy | home | copyright_id_bit | copyright_id_start | frame_length | buffer_fullness | raw_data_blocks |
+//	| (1)           | (1)  | (1)              | (1)                | (13)         | (11)            | (2)             |
+//	+---------------+------+------------------+--------------------+--------------+-----------------+-----------------+
+func (c *AudioSpecificConfig) ADTSHeader(frameSize int) ([]byte, error) {
+	// The profile of ADTS is the object type minus 1, which has only 2 bits.
+	if c.ObjectType < ObjectTypeMain || c.ObjectType > ObjectTypeLTP {
+		return nil, errUnsupportedADTSObjectType
+	}
+	if c.SampleRateIndex == explicitSampleRateIndex {
+		return nil, errUnsupportedADTSSampleRate
+	}
+	length := ADTSHeaderSize + frameSize
+	if length > maxADTSFrameLength {
+		return nil, errADTSFrameTooLarge
+	}
+	profile := c.ObjectType - 1
+	return []byte{
+		0xff,
+		0xf1, // MPEG-4, layer 0, no CRC
+		profile<<6 | c.SampleRateIndex<<2 | c.ChannelConfig>>2&0x01,
+		c.ChannelConfig&0x03<<6 | byte(length>>11),
+		byte(length >> 3),
+		byte(length)<<5 | 0x1f, // buffer fullness 0x7ff means VBR
+		0xfc,                   // one raw data block
+	}, nil
+}
+
+// An ADTSWriter writes raw AAC frames with ADTS headers, like .aac files and MPEG-TS streams.
+type ADTSWriter struct {
+	w      io.Writer
+	config *AudioSpecificConfig
+}
+
+func NewADTSWriter(w io.Writer, config *AudioSpecificConfig) *ADTSWriter {
+	return &ADTSWriter{w: w, config: config}
+}
+
+// Write writes a raw AAC frame, which is the data of an AAC raw message, with the ADTS header.
+func (w *ADTSWriter) Write(frame []byte) (int, error) {
+	header, err := w.config.ADTSHeader(len(frame))
+	if err != nil {
+		return 0, err
+	}
+	if _, err = w.w.Write(header); err != nil {
+		return 0, err
+	}
+	return w.w.Write(frame)
+}
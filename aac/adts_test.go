@@ -0,0 +1,30 @@
+package aac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestADTSWriter(t *testing.T) {
+	c, err := ParseAudioSpecificConfig([]byte{0x12, 0x10})
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	buf := new(bytes.Buffer)
+	w := NewADTSWriter(buf, c)
+	if _, err = w.Write([]byte{0x21, 0x00, 0x49}); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	want := []byte{0xff, 0xf1, 0x50, 0x80, 0x01, 0x5f, 0xfc, 0x21, 0x00, 0x49}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("should be %#v, but got %#v", want, buf.Bytes())
+	}
+
+	if _, err = w.Write(make([]byte, maxADTSFrameLength)); err != errADTSFrameTooLarge {
+		t.Errorf("should be errADTSFrameTooLarge, but got %v", err)
+	}
+	c.SampleRateIndex = explicitSampleRateIndex
+	if _, err = c.ADTSHeader(1); err != errUnsupportedADTSSampleRate {
+		t.Errorf("should be errUnsupportedADTSSampleRate, but got %v", err)
+	}
+}
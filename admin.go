@@ -0,0 +1,46 @@
+package rtmp
+
+import (
+	"net/http"
+)
+
+// AdminHandler returns the handler of the admin HTTP API, which controls the live streams of the server.
+//
+//	POST /recordings/start?app={app}&name={name}  starts recording the stream with StartRecording
+//	POST /recordings/stop?app={app}&name={name}   stops recording the stream with StopRecording
+//
+// It responds 204 on success. It has no authentication, so that it should not be exposed to untrusted clients.
+func (srv *Server) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/recordings/start", adminRecordingHandler(srv.StartRecording))
+	mux.HandleFunc("/recordings/stop", adminRecordingHandler(srv.StopRecording))
+	return mux
+}
+
+func adminRecordingHandler(f func(app, name string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		app, name := r.URL.Query().Get("app"), r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+
+		switch err := f(app, name); err {
+		case nil:
+			w.WriteHeader(http.StatusNoContent)
+		case errStreamNotPublished, errNotRecording:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errAlreadyRecording:
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errRecordingDisabled:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
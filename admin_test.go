@@ -0,0 +1,42 @@
+package rtmp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestAdminHandler(t *testing.T) {
+	c, client := newConnectedTestConn()
+	defer client.Close()
+	srv := c.server
+	srv.DVRPolicies = map[string]DVRPolicy{
+		"live": {Path: filepath.Join(t.TempDir(), "{name}.flv"), Manual: true},
+	}
+	c.app = "live"
+	if _, err := srv.publishStream("cam", &netStream{id: 1, conn: c}); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+
+	h := srv.AdminHandler()
+	for _, tt := range []struct {
+		method string
+		target string
+		status int
+	}{
+		{http.MethodGet, "/recordings/start?app=live&name=cam", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/recordings/start", http.StatusBadRequest},
+		{http.MethodPost, "/recordings/start?app=live&name=tv", http.StatusNotFound},
+		{http.MethodPost, "/recordings/stop?app=live&name=cam", http.StatusNotFound},
+		{http.MethodPost, "/recordings/start?app=live&name=cam", http.StatusNoContent},
+		{http.MethodPost, "/recordings/start?app=live&name=cam", http.StatusConflict},
+		{http.MethodPost, "/recordings/stop?app=live&name=cam", http.StatusNoContent},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s %s should be %d, but got %d", tt.method, tt.target, tt.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/zhangpeihao/goamf"
+)
+
+// A strictArray is written as an AMF0 strict array by writeAMF0Value, while goamf writes
+// slices as ECMA arrays.
+type strictArray []interface{}
+
+// writeAMF0Value writes the value like amf.WriteValue, except that strict arrays are written
+// as AMF0 strict arrays even if they are in objects. Properties of objects are sorted by name.
+func writeAMF0Value(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case strictArray:
+		buf.WriteByte(amf.AMF0_STRICT_ARRAY_MARKER)
+		binary.Write(buf, binary.BigEndian, uint32(len(v)))
+		for _, e := range v {
+			if err := writeAMF0Value(buf, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case amf.Object:
+		return writeAMF0Object(buf, v)
+	case map[string]interface{}:
+		if v == nil {
+			_, err := amf.WriteNull(buf)
+			return err
+		}
+		return writeAMF0Object(buf, v)
+	}
+	_, err := amf.WriteValue(buf, value)
+	return err
+}
+
+func writeAMF0Object(buf *bytes.Buffer, obj map[string]interface{}) error {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf.WriteByte(amf.AMF0_OBJECT_MARKER)
+	for _, k := range keys {
+		if _, err := amf.WriteObjectName(buf, k); err != nil {
+			return err
+		}
+		if err := writeAMF0Value(buf, obj[k]); err != nil {
+			return err
+		}
+	}
+	_, err := amf.WriteObjectEndMarker(buf)
+	return err
+}
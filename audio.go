@@ -0,0 +1,248 @@
+package rtmp
+
+import (
+	"errors"
+	"fmt"
+)
+
+type SoundFormat uint8
+
+const (
+	SoundFormatLinearPCMPlatformEndian SoundFormat = 0
+	SoundFormatADPCM                               = 1
+	SoundFormatMP3                                 = 2
+	SoundFormatLinearPCMLittleEndian               = 3
+	SoundFormatNellymoser16kHzMono                 = 4
+	SoundFormatNellymoser8kHzMono                  = 5
+	SoundFormatNellymoser                          = 6
+	SoundFormatG711ALaw                            = 7
+	SoundFormatG711MuLaw                           = 8
+	SoundFormatExHeader                            = 9
+	SoundFormatAAC                                 = 10
+	SoundFormatSpeex                               = 11
+	SoundFormatMP38kHz                             = 14
+	SoundFormatDeviceSpecific                      = 15
+)
+
+var soundFormatNames = map[SoundFormat]string{
+	SoundFormatLinearPCMPlatformEndian: "Linear PCM, platform endian",
+	SoundFormatADPCM:                   "ADPCM",
+	SoundFormatMP3:                     "MP3",
+	SoundFormatLinearPCMLittleEndian:   "Linear PCM, little endian",
+	SoundFormatNellymoser16kHzMono:     "Nellymoser 16 kHz mono",
+	SoundFormatNellymoser8kHzMono:      "Nellymoser 8 kHz mono",
+	SoundFormatNellymoser:              "Nellymoser",
+	SoundFormatG711ALaw:                "G.711 A-law",
+	SoundFormatG711MuLaw:               "G.711 mu-law",
+	SoundFormatExHeader:                "ExHeader",
+	SoundFormatAAC:                     "AAC",
+	SoundFormatSpeex:                   "Speex",
+	SoundFormatMP38kHz:                 "MP3 8 kHz",
+	SoundFormatDeviceSpecific:          "Device-specific sound",
+}
+
+func (f SoundFormat) String() string {
+	if name, ok := soundFormatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("SoundFormat(%d)", uint8(f))
+}
+
+type AACPacketType uint8
+
+const (
+	AACPacketTypeSequenceHeader AACPacketType = 0
+	AACPacketTypeRaw                          = 1
+)
+
+// An AudioPacketType is the type of the audio packet with the Enhanced RTMP extended header (ExAudio).
+type AudioPacketType uint8
+
+const (
+	AudioPacketTypeSequenceStart      AudioPacketType = 0
+	AudioPacketTypeCodedFrames                        = 1
+	AudioPacketTypeSequenceEnd                        = 2
+	AudioPacketTypeMultichannelConfig                 = 4
+	AudioPacketTypeMultitrack                         = 5
+	AudioPacketTypeModEx                              = 7
+)
+
+var errInvalidAudioTag = errors.New("invalid audio tag")
+
+var soundRates = [4]int{5512, 11025, 22050, 44100}
+
+// An AudioPacket is the payload of an audio message, which is an FLV audio tag without the tag header.
+//
+//	+-------------+-----------+-----------+-----------+---------------+---------------
+//	| SoundFormat | SoundRate | SoundSize | SoundType | AACPacketType | Data
+//	| (4 bits)    | (2 bits)  | (1 bit)   | (1 bit)   | (8 bits, AAC) |
+//	+-------------+-----------+-----------+-----------+---------------+---------------
+//
+// If SoundFormat is ExHeader, the codec is identified by a FourCC, like Opus, FLAC, AC-3 and E-AC-3.
+//
+//	+-------------+------------+-----------+---------------
+//	| SoundFormat | PacketType | FourCC    | Data
+//	| (4 bits)    | (4 bits)   | (32 bits) |
+//	+-------------+------------+-----------+---------------
+type AudioPacket struct {
+	SoundFormat SoundFormat
+	SoundRate   uint8 // 0: 5.5 kHz, 1: 11 kHz, 2: 22 kHz, 3: 44 kHz
+	SoundSize   uint8 // 0: 8-bit samples, 1: 16-bit samples
+	SoundType   uint8 // 0: mono, 1: stereo
+	// AACPacketType is present only if SoundFormat is AAC.
+	AACPacketType AACPacketType
+
+	// PacketType and FourCC are present only if SoundFormat is ExHeader.
+	PacketType AudioPacketType
+	FourCC     FourCC
+	// IsMultitrack reports whether the packet has multiple tracks. PacketType is the type of
+	// the tracks, and FourCC is 0 if the tracks have different codecs.
+	IsMultitrack   bool
+	MultitrackType MultitrackType
+	// Tracks are the tracks of the multitrack packet, and TrackID is the ID of each track.
+	Tracks  []*AudioPacket
+	TrackID uint8
+
+	// Data is the codec configuration for sequence headers, like the AudioSpecificConfig of AAC,
+	// otherwise the audio frame.
+	Data []byte
+}
+
+// ReadAudioPacket parses the payload of an audio message.
+func ReadAudioPacket(payload []byte) (*AudioPacket, error) {
+	if len(payload) < 1 {
+		return nil, errInvalidAudioTag
+	}
+	p := &AudioPacket{
+		SoundFormat: SoundFormat(payload[0] >> 4),
+		SoundRate:   (payload[0] >> 2) & 0x03,
+		SoundSize:   (payload[0] >> 1) & 0x01,
+		SoundType:   payload[0] & 0x01,
+		Data:        payload[1:],
+	}
+	switch p.SoundFormat {
+	case SoundFormatAAC:
+		if len(payload) < 2 {
+			return nil, errInvalidAudioTag
+		}
+		p.AACPacketType = AACPacketType(payload[1])
+		p.Data = payload[2:]
+	case SoundFormatExHeader:
+		if err := p.readExHeader(payload); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *AudioPacket) readExHeader(payload []byte) error {
+	p.SoundRate, p.SoundSize, p.SoundType = 0, 0, 0
+	p.PacketType = AudioPacketType(payload[0] & 0x0f)
+	data := payload[1:]
+	if p.PacketType == AudioPacketTypeModEx {
+		packetType, rest, err := skipModEx(data)
+		if err != nil {
+			return errInvalidAudioTag
+		}
+		p.PacketType, data = AudioPacketType(packetType), rest
+	}
+	if p.PacketType != AudioPacketTypeMultitrack {
+		fourCC, rest, err := readFourCC(data)
+		if err != nil {
+			return errInvalidAudioTag
+		}
+		p.FourCC, p.Data = fourCC, rest
+		return nil
+	}
+
+	mt, err := readMultitrack(data)
+	if err != nil {
+		return errInvalidAudioTag
+	}
+	p.IsMultitrack = true
+	p.MultitrackType = mt.multitrackType
+	p.PacketType = AudioPacketType(mt.packetType)
+	p.FourCC = mt.fourCC
+	p.Data = nil
+	for _, t := range mt.tracks {
+		p.Tracks = append(p.Tracks, &AudioPacket{
+			SoundFormat: SoundFormatExHeader,
+			PacketType:  p.PacketType,
+			FourCC:      t.fourCC,
+			TrackID:     t.id,
+			Data:        t.body,
+		})
+	}
+	return nil
+}
+
+// IsSequenceHeader reports whether the packet is a sequence header, which carries the codec
+// configuration, like the AudioSpecificConfig of AAC.
+func (p *AudioPacket) IsSequenceHeader() bool {
+	if p.SoundFormat == SoundFormatExHeader {
+		return p.PacketType == AudioPacketTypeSequenceStart
+	}
+	return p.SoundFormat == SoundFormatAAC && p.AACPacketType == AACPacketTypeSequenceHeader
+}
+
+// SampleRate returns the sampling rate in Hz. Some formats have fixed rates regardless of SoundRate.
+// For AAC and ExHeader, the actual rate is in the codec configuration.
+func (p *AudioPacket) SampleRate() int {
+	switch p.SoundFormat {
+	case SoundFormatNellymoser8kHzMono, SoundFormatMP38kHz, SoundFormatG711ALaw, SoundFormatG711MuLaw:
+		return 8000
+	case SoundFormatNellymoser16kHzMono, SoundFormatSpeex:
+		return 16000
+	}
+	return soundRates[p.SoundRate]
+}
+
+// SampleSize returns the size of each sample in bits.
+func (p *AudioPacket) SampleSize() int {
+	if p.SoundSize == 1 {
+		return 16
+	}
+	return 8
+}
+
+// Channels returns the number of channels. Nellymoser 8/16 kHz and Speex are always mono.
+// For AAC and ExHeader, the actual number is in the codec configuration.
+func (p *AudioPacket) Channels() int {
+	switch p.SoundFormat {
+	case SoundFormatNellymoser16kHzMono, SoundFormatNellymoser8kHzMono, SoundFormatSpeex:
+		return 1
+	}
+	return int(p.SoundType) + 1
+}
+
+// trackIDs returns the IDs of the tracks of the packet. Packets without multiple tracks are for the default track.
+func (p *AudioPacket) trackIDs() []uint8 {
+	if !p.IsMultitrack {
+		return []uint8{defaultTrack}
+	}
+	ids := make([]uint8, 0, len(p.Tracks))
+	for _, t := range p.Tracks {
+		ids = append(ids, t.TrackID)
+	}
+	return ids
+}
+
+// hasSequenceHeader reports whether the format has the codec configuration in the sequence header,
+// instead of in the header of every packet.
+func (p *AudioPacket) hasSequenceHeader() bool {
+	return p.SoundFormat == SoundFormatAAC || p.SoundFormat == SoundFormatExHeader
+}
+
+// track returns the packet of the track, which is the packet itself if it does not have multiple tracks.
+// It returns nil if the multitrack packet does not have the track.
+func (p *AudioPacket) track(id uint8) *AudioPacket {
+	if !p.IsMultitrack {
+		return p
+	}
+	for _, t := range p.Tracks {
+		if t.TrackID == id {
+			return t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package rtmp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReadAudioPacket(t *testing.T) {
+	p, err := ReadAudioPacket([]byte{0xaf, 0x00, 0x12, 0x10})
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if p.SoundFormat != SoundFormatAAC || !p.IsSequenceHeader() {
+		t.Errorf("should be AAC sequence header, but got %s (AACPacketType: %d)", p.SoundFormat, p.AACPacketType)
+	}
+	if p.SampleRate() != 44100 || p.SampleSize() != 16 || p.Channels() != 2 {
+		t.Errorf("should be 44100 Hz, 16 bits, 2 channels, but got %d Hz, %d bits, %d channels", p.SampleRate(), p.SampleSize(), p.Channels())
+	}
+	if bytes.Compare(p.Data, []byte{0x12, 0x10}) != 0 {
+		t.Errorf("should be %#v, but got %#v", []byte{0x12, 0x10}, p.Data)
+	}
+
+	for _, tt := range []struct {
+		payload    []byte
+		format     SoundFormat
+		sampleRate int
+		channels   int
+	}{
+		{[]byte{0x2f, 0xff}, SoundFormatMP3, 44100, 2},
+		{[]byte{0x52, 0xff}, SoundFormatNellymoser8kHzMono, 8000, 1},
+		{[]byte{0xb6, 0xff}, SoundFormatSpeex, 16000, 1},
+		{[]byte{0x72, 0xff}, SoundFormatG711ALaw, 8000, 1},
+	} {
+		p, err := ReadAudioPacket(tt.payload)
+		if err != nil {
+			t.Errorf("should be nil, but got %s", err)
+			continue
+		}
+		if p.SoundFormat != tt.format || p.SampleRate() != tt.sampleRate || p.Channels() != tt.channels || p.IsSequenceHeader() {
+			t.Errorf("should be %s (%d Hz, %d channels), but got %s (%d Hz, %d channels)", tt.format, tt.sampleRate, tt.channels, p.SoundFormat, p.SampleRate(), p.Channels())
+		}
+	}
+
+	if _, err = ReadAudioPacket([]byte{0xaf}); err == nil {
+		t.Errorf("should be error for AAC without AACPacketType")
+	}
+}
+
+func TestReadExAudioPacket(t *testing.T) {
+	p, err := ReadAudioPacket([]byte{0x90, 'O', 'p', 'u', 's', 0x4f, 0x70})
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if p.SoundFormat != SoundFormatExHeader || p.FourCC != FourCCOpus || !p.IsSequenceHeader() || len(p.Data) != 2 {
+		t.Errorf("should be Opus sequence header, but got %#v", p)
+	}
+
+	// ModEx with a 1-byte modifier, followed by CodedFrames of FLAC
+	p, err = ReadAudioPacket([]byte{0x97, 0x00, 0x00, 0x01, 'f', 'L', 'a', 'C', 0xff})
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if p.FourCC != FourCCFLAC || p.PacketType != AudioPacketTypeCodedFrames || p.IsSequenceHeader() || len(p.Data) != 1 {
+		t.Errorf("should be FLAC coded frames, but got %#v", p)
+	}
+
+	// Two tracks of AC-3 and E-AC-3
+	p, err = ReadAudioPacket([]byte{
+		0x95, 0x21,
+		'a', 'c', '-', '3', 0x00, 0x00, 0x00, 0x02, 0x0b, 0x77,
+		'e', 'c', '-', '3', 0x01, 0x00, 0x00, 0x01, 0x0b,
+	})
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if !p.IsMultitrack || p.MultitrackType != MultitrackTypeManyTracksManyCodecs || p.PacketType != AudioPacketTypeCodedFrames || len(p.Tracks) != 2 {
+		t.Fatalf("should be multitrack coded frames with 2 tracks, but got %#v", p)
+	}
+	for i, tt := range []struct {
+		trackID uint8
+		fourCC  FourCC
+		data    []byte
+	}{
+		{0, FourCCAC3, []byte{0x0b, 0x77}},
+		{1, FourCCEAC3, []byte{0x0b}},
+	} {
+		track := p.Tracks[i]
+		if track.TrackID != tt.trackID || track.FourCC != tt.fourCC || !bytes.Equal(track.Data, tt.data) {
+			t.Errorf("should be track %d of %s, but got %#v", tt.trackID, tt.fourCC, track)
+		}
+	}
+
+	if _, err = ReadAudioPacket([]byte{0x95, 0x11, 'O', 'p', 'u', 's', 0x00, 0x00, 0x00, 0x05, 0x01}); err == nil {
+		t.Errorf("should be error for the truncated track")
+	}
+}
@@ -0,0 +1,85 @@
+// Package avc parses the headers of H.264/AVC video, which are carried by the sequence headers
+// of RTMP video messages.
+package avc
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errInvalidDecoderConfigurationRecord = errors.New("avc: invalid AVCDecoderConfigurationRecord")
+
+// A DecoderConfigurationRecord is the AVCDecoderConfigurationRecord defined in ISO/IEC 14496-15,
+// which is the data of AVC sequence headers.
+//
+//	+----------------------+----------------------+-----------------------+--------------------+
+//	| configurationVersion | AVCProfileIndication | profile_compatibility | AVCLevelIndication |
+//	| (8 bits)             | (8 bits)             | (8 bits)              | (8 bits)           |
+//	+----------+-----------+--------+----------+--+-----------------------+----------------+---
+//	| reserved | lengthSizeMinusOne | reserved | numOfSequenceParameterSets | SPS ...
+//	| (6 bits) | (2 bits)           | (3 bits) | (5 bits)                   |
+//	+----------+--------------------+----------+----------------------------+-----------------
+//	| numOfPictureParameterSets | PPS ...
+//	| (8 bits)                  |
+//	+---------------------------+-----------------
+//
+// Each SPS and PPS is a NAL unit which has the 16-bit length.
+type DecoderConfigurationRecord struct {
+	ConfigurationVersion uint8
+	ProfileIndication    uint8
+	ProfileCompatibility uint8
+	LevelIndication      uint8
+	// LengthSize is the size in bytes of the length of each NAL unit in video frames.
+	LengthSize int
+	SPS        [][]byte
+	PPS        [][]byte
+}
+
+// ParseDecoderConfigurationRecord parses the AVCDecoderConfigurationRecord.
+func ParseDecoderConfigurationRecord(data []byte) (*DecoderConfigurationRecord, error) {
+	if len(data) < 6 {
+		return nil, errInvalidDecoderConfigurationRecord
+	}
+	r := &DecoderConfigurationRecord{
+		ConfigurationVersion: data[0],
+		ProfileIndication:    data[1],
+		ProfileCompatibility: data[2],
+		LevelIndication:      data[3],
+		LengthSize:           int(data[4]&0x03) + 1,
+	}
+	if r.ConfigurationVersion != 1 {
+		return nil, errInvalidDecoderConfigurationRecord
+	}
+
+	var err error
+	numSPS := int(data[5] & 0x1f)
+	data = data[6:]
+	if r.SPS, data, err = readParameterSets(data, numSPS); err != nil {
+		return nil, err
+	}
+	if len(data) < 1 {
+		return nil, errInvalidDecoderConfigurationRecord
+	}
+	numPPS := int(data[0])
+	if r.PPS, _, err = readParameterSets(data[1:], numPPS); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func readParameterSets(data []byte, n int) ([][]byte, []byte, error) {
+	sets := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		if len(data) < 2 {
+			return nil, nil, errInvalidDecoderConfigurationRecord
+		}
+		size := int(binary.BigEndian.Uint16(data))
+		data = data[2:]
+		if len(data) < size {
+			return nil, nil, errInvalidDecoderConfigurationRecord
+		}
+		sets = append(sets, data[:size])
+		data = data[size:]
+	}
+	return sets, data, nil
+}
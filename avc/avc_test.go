@@ -0,0 +1,36 @@
+package avc
+
+import (
+	"bytes"
+	"testing"
+)
+
+var (
+	testSPS = []byte{0x67, 0x42, 0x00, 0x1e, 0x95, 0xa8, 0x28, 0x0f, 0x64}
+	testPPS = []byte{0x68, 0xce, 0x3c, 0x80}
+)
+
+func TestParseDecoderConfigurationRecord(t *testing.T) {
+	data := []byte{0x01, 0x42, 0x00, 0x1e, 0xff, 0xe1, 0x00, 0x09}
+	data = append(data, testSPS...)
+	data = append(data, 0x01, 0x00, 0x04)
+	data = append(data, testPPS...)
+
+	r, err := ParseDecoderConfigurationRecord(data)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if r.ProfileIndication != 66 || r.LevelIndication != 30 || r.LengthSize != 4 {
+		t.Errorf("should be profile 66, level 30 and length size 4, but got %d, %d and %d", r.ProfileIndication, r.LevelIndication, r.LengthSize)
+	}
+	if len(r.SPS) != 1 || !bytes.Equal(r.SPS[0], testSPS) {
+		t.Errorf("should be %#v, but got %#v", [][]byte{testSPS}, r.SPS)
+	}
+	if len(r.PPS) != 1 || !bytes.Equal(r.PPS[0], testPPS) {
+		t.Errorf("should be %#v, but got %#v", [][]byte{testPPS}, r.PPS)
+	}
+
+	if _, err = ParseDecoderConfigurationRecord(data[:10]); err == nil {
+		t.Errorf("should be error for the truncated SPS")
+	}
+}
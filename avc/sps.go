@@ -0,0 +1,392 @@
+package avc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/c-bata/rtmp/internal/bits"
+)
+
+var errInvalidSPS = errors.New("avc: invalid SPS")
+
+// NAL unit type of the SPS.
+const nalUnitTypeSPS = 7
+
+// An SPS is the sequence parameter set defined in ITU-T H.264, which has the properties of the video.
+type SPS struct {
+	ProfileIDC uint8
+	// ConstraintFlags are constraint_set0_flag to constraint_set5_flag from the most significant bit.
+	ConstraintFlags   uint8
+	LevelIDC          uint8
+	SeqParameterSetID uint
+
+	ChromaFormatIDC uint
+	BitDepthLuma    uint
+	BitDepthChroma  uint
+
+	// Width and Height are the size of the pictures in pixels, excluding the cropped area.
+	Width          int
+	Height         int
+	FrameMBSOnly   bool
+	MaxRefFrames   uint
+	SARWidth       uint
+	SARHeight      uint
+	FullRange      bool
+	NumUnitsInTick uint32
+	TimeScale      uint32
+	FixedFrameRate bool
+}
+
+// ProfileName returns the name of the profile, like "High".
+func (s *SPS) ProfileName() string {
+	switch s.ProfileIDC {
+	case 66:
+		if s.ConstraintFlags&0x40 != 0 {
+			return "Constrained Baseline"
+		}
+		return "Baseline"
+	case 77:
+		return "Main"
+	case 88:
+		return "Extended"
+	case 100:
+		return "High"
+	case 110:
+		return "High 10"
+	case 122:
+		return "High 4:2:2"
+	case 244:
+		return "High 4:4:4 Predictive"
+	case 44:
+		return "CAVLC 4:4:4 Intra"
+	}
+	return fmt.Sprintf("Profile(%d)", s.ProfileIDC)
+}
+
+// Level returns the level, like 3.1.
+func (s *SPS) Level() float64 {
+	return float64(s.LevelIDC) / 10
+}
+
+// FrameRate returns the frame rate from the timing information of the VUI, or 0 if it is absent.
+func (s *SPS) FrameRate() float64 {
+	if s.NumUnitsInTick == 0 {
+		return 0
+	}
+	// A frame has two fields.
+	return float64(s.TimeScale) / float64(2*s.NumUnitsInTick)
+}
+
+// hasChromaFormat reports whether the SPS of the profile has chroma_format_idc and the bit depths.
+func hasChromaFormat(profileIDC uint8) bool {
+	switch profileIDC {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		return true
+	}
+	return false
+}
+
+// ParseSPS parses the NAL unit of the SPS, which has the emulation prevention bytes.
+func ParseSPS(nalu []byte) (*SPS, error) {
+	if len(nalu) < 4 || nalu[0]&0x1f != nalUnitTypeSPS {
+		return nil, errInvalidSPS
+	}
+	rbsp := bits.RemoveEmulationPrevention(nalu[1:])
+	if len(rbsp) < 3 {
+		return nil, errInvalidSPS
+	}
+	s := &SPS{
+		ProfileIDC:      rbsp[0],
+		ConstraintFlags: rbsp[1],
+		LevelIDC:        rbsp[2],
+		ChromaFormatIDC: 1,
+		BitDepthLuma:    8,
+		BitDepthChroma:  8,
+	}
+	if err := s.parse(bits.NewReader(rbsp[3:])); err != nil {
+		return nil, errInvalidSPS
+	}
+	return s, nil
+}
+
+func (s *SPS) parse(r *bits.Reader) error {
+	var err error
+	if s.SeqParameterSetID, err = r.ReadUE(); err != nil {
+		return err
+	}
+
+	separateColourPlane := false
+	if hasChromaFormat(s.ProfileIDC) {
+		if s.ChromaFormatIDC, err = r.ReadUE(); err != nil {
+			return err
+		}
+		if s.ChromaFormatIDC == 3 {
+			if separateColourPlane, err = r.ReadFlag(); err != nil {
+				return err
+			}
+		}
+		var depth uint
+		if depth, err = r.ReadUE(); err != nil {
+			return err
+		}
+		s.BitDepthLuma = depth + 8
+		if depth, err = r.ReadUE(); err != nil {
+			return err
+		}
+		s.BitDepthChroma = depth + 8
+		// qpprime_y_zero_transform_bypass_flag
+		if err = r.Skip(1); err != nil {
+			return err
+		}
+		if err = skipScalingMatrix(r, s.ChromaFormatIDC); err != nil {
+			return err
+		}
+	}
+
+	// log2_max_frame_num_minus4
+	if _, err = r.ReadUE(); err != nil {
+		return err
+	}
+	if err = skipPicOrderCnt(r); err != nil {
+		return err
+	}
+	if s.MaxRefFrames, err = r.ReadUE(); err != nil {
+		return err
+	}
+	// gaps_in_frame_num_value_allowed_flag
+	if err = r.Skip(1); err != nil {
+		return err
+	}
+
+	widthInMBs, err := r.ReadUE()
+	if err != nil {
+		return err
+	}
+	heightInMapUnits, err := r.ReadUE()
+	if err != nil {
+		return err
+	}
+	if s.FrameMBSOnly, err = r.ReadFlag(); err != nil {
+		return err
+	}
+	if !s.FrameMBSOnly {
+		// mb_adaptive_frame_field_flag
+		if err = r.Skip(1); err != nil {
+			return err
+		}
+	}
+	// direct_8x8_inference_flag
+	if err = r.Skip(1); err != nil {
+		return err
+	}
+
+	frameHeightFactor := 1
+	if !s.FrameMBSOnly {
+		frameHeightFactor = 2
+	}
+	s.Width = int(widthInMBs+1) * 16
+	s.Height = frameHeightFactor * int(heightInMapUnits+1) * 16
+
+	cropping, err := r.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if cropping {
+		var crop [4]uint // left, right, top and bottom
+		for i := range crop {
+			if crop[i], err = r.ReadUE(); err != nil {
+				return err
+			}
+		}
+		cropUnitX, cropUnitY := 1, frameHeightFactor
+		if s.ChromaFormatIDC != 0 && !separateColourPlane {
+			// SubWidthC and SubHeightC of 4:2:0, 4:2:2 and 4:4:4.
+			subWidth := [4]int{0, 2, 2, 1}
+			subHeight := [4]int{0, 2, 1, 1}
+			if s.ChromaFormatIDC > 3 {
+				return errInvalidSPS
+			}
+			cropUnitX = subWidth[s.ChromaFormatIDC]
+			cropUnitY = subHeight[s.ChromaFormatIDC] * frameHeightFactor
+		}
+		s.Width -= int(crop[0]+crop[1]) * cropUnitX
+		s.Height -= int(crop[2]+crop[3]) * cropUnitY
+	}
+
+	vui, err := r.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if vui {
+		return s.parseVUI(r)
+	}
+	return nil
+}
+
+func skipScalingMatrix(r *bits.Reader, chromaFormatIDC uint) error {
+	present, err := r.ReadFlag()
+	if err != nil || !present {
+		return err
+	}
+	n := 8
+	if chromaFormatIDC == 3 {
+		n = 12
+	}
+	for i := 0; i < n; i++ {
+		listPresent, err := r.ReadFlag()
+		if err != nil {
+			return err
+		}
+		if !listPresent {
+			continue
+		}
+		size := 16
+		if i >= 6 {
+			size = 64
+		}
+		last, next := 8, 8
+		for j := 0; j < size; j++ {
+			if next != 0 {
+				delta, err := r.ReadSE()
+				if err != nil {
+					return err
+				}
+				next = (last + delta + 256) % 256
+			}
+			if next != 0 {
+				last = next
+			}
+		}
+	}
+	return nil
+}
+
+func skipPicOrderCnt(r *bits.Reader) error {
+	picOrderCntType, err := r.ReadUE()
+	if err != nil {
+		return err
+	}
+	switch picOrderCntType {
+	case 0:
+		// log2_max_pic_order_cnt_lsb_minus4
+		_, err = r.ReadUE()
+		return err
+	case 1:
+		// delta_pic_order_always_zero_flag
+		if err = r.Skip(1); err != nil {
+			return err
+		}
+		// offset_for_non_ref_pic and offset_for_top_to_bottom_field
+		for i := 0; i < 2; i++ {
+			if _, err = r.ReadSE(); err != nil {
+				return err
+			}
+		}
+		n, err := r.ReadUE()
+		if err != nil {
+			return err
+		}
+		for i := uint(0); i < n; i++ {
+			if _, err = r.ReadSE(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// extendedSAR is the aspect_ratio_idc of which the SAR is written explicitly.
+const extendedSAR = 255
+
+// sampleAspectRatios are the SARs of aspect_ratio_idc from 1 to 16.
+var sampleAspectRatios = [][2]uint{
+	{1, 1}, {12, 11}, {10, 11}, {16, 11}, {40, 33}, {24, 11}, {20, 11}, {32, 11},
+	{80, 33}, {18, 11}, {15, 11}, {64, 33}, {160, 99}, {4, 3}, {3, 2}, {2, 1},
+}
+
+// parseVUI parses the video usability information up to the timing information.
+func (s *SPS) parseVUI(r *bits.Reader) error {
+	aspectRatio, err := r.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if aspectRatio {
+		idc, err := r.ReadBits(8)
+		if err != nil {
+			return err
+		}
+		if idc == extendedSAR {
+			if s.SARWidth, err = r.ReadBits(16); err != nil {
+				return err
+			}
+			if s.SARHeight, err = r.ReadBits(16); err != nil {
+				return err
+			}
+		} else if idc >= 1 && int(idc) <= len(sampleAspectRatios) {
+			s.SARWidth, s.SARHeight = sampleAspectRatios[idc-1][0], sampleAspectRatios[idc-1][1]
+		}
+	}
+
+	overscan, err := r.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if overscan {
+		// overscan_appropriate_flag
+		if err = r.Skip(1); err != nil {
+			return err
+		}
+	}
+
+	videoSignalType, err := r.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if videoSignalType {
+		// video_format
+		if err = r.Skip(3); err != nil {
+			return err
+		}
+		if s.FullRange, err = r.ReadFlag(); err != nil {
+			return err
+		}
+		colourDescription, err := r.ReadFlag()
+		if err != nil {
+			return err
+		}
+		if colourDescription {
+			// colour_primaries, transfer_characteristics and matrix_coefficients
+			if err = r.Skip(24); err != nil {
+				return err
+			}
+		}
+	}
+
+	chromaLoc, err := r.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if chromaLoc {
+		for i := 0; i < 2; i++ {
+			if _, err = r.ReadUE(); err != nil {
+				return err
+			}
+		}
+	}
+
+	timing, err := r.ReadFlag()
+	if err != nil || !timing {
+		return err
+	}
+	numUnitsInTick, err := r.ReadBits(32)
+	if err != nil {
+		return err
+	}
+	timeScale, err := r.ReadBits(32)
+	if err != nil {
+		return err
+	}
+	s.NumUnitsInTick, s.TimeScale = uint32(numUnitsInTick), uint32(timeScale)
+	s.FixedFrameRate, err = r.ReadFlag()
+	return err
+}
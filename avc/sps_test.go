@@ -0,0 +1,80 @@
+package avc
+
+import (
+	"testing"
+
+	"github.com/c-bata/rtmp/internal/bits"
+)
+
+func TestParseSPS(t *testing.T) {
+	s, err := ParseSPS(testSPS)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if s.ProfileName() != "Baseline" || s.Level() != 3 || s.Width != 640 || s.Height != 480 || s.FrameRate() != 0 {
+		t.Errorf("should be Baseline 3.0, 640x480, but got %s %.1f, %dx%d (%f fps)", s.ProfileName(), s.Level(), s.Width, s.Height, s.FrameRate())
+	}
+}
+
+func TestParseHighProfileSPS(t *testing.T) {
+	w := &bits.Writer{}
+	w.WriteBits(0x67, 8)
+	w.WriteBits(100, 8) // profile_idc
+	w.WriteBits(0, 8)   // constraint flags
+	w.WriteBits(40, 8)  // level_idc
+	w.WriteUE(0)        // seq_parameter_set_id
+	w.WriteUE(1)        // chroma_format_idc
+	w.WriteUE(0)        // bit_depth_luma_minus8
+	w.WriteUE(0)        // bit_depth_chroma_minus8
+	w.WriteBits(0, 1)   // qpprime_y_zero_transform_bypass_flag
+	w.WriteBits(0, 1)   // seq_scaling_matrix_present_flag
+	w.WriteUE(0)        // log2_max_frame_num_minus4
+	w.WriteUE(0)        // pic_order_cnt_type
+	w.WriteUE(2)        // log2_max_pic_order_cnt_lsb_minus4
+	w.WriteUE(4)        // max_num_ref_frames
+	w.WriteBits(0, 1)   // gaps_in_frame_num_value_allowed_flag
+	w.WriteUE(119)      // pic_width_in_mbs_minus1
+	w.WriteUE(67)       // pic_height_in_map_units_minus1
+	w.WriteBits(1, 1)   // frame_mbs_only_flag
+	w.WriteBits(1, 1)   // direct_8x8_inference_flag
+	w.WriteBits(1, 1)   // frame_cropping_flag
+	w.WriteUE(0)
+	w.WriteUE(0)
+	w.WriteUE(0)
+	w.WriteUE(4)
+	w.WriteBits(1, 1) // vui_parameters_present_flag
+	w.WriteBits(1, 1) // aspect_ratio_info_present_flag
+	w.WriteBits(1, 8) // aspect_ratio_idc
+	w.WriteBits(0, 1) // overscan_info_present_flag
+	w.WriteBits(1, 1) // video_signal_type_present_flag
+	w.WriteBits(5, 3) // video_format
+	w.WriteBits(1, 1) // video_full_range_flag
+	w.WriteBits(0, 1) // colour_description_present_flag
+	w.WriteBits(0, 1) // chroma_loc_info_present_flag
+	w.WriteBits(1, 1) // timing_info_present_flag
+	w.WriteBits(1001, 32)
+	w.WriteBits(60000, 32)
+	w.WriteBits(1, 1) // fixed_frame_rate_flag
+	w.WriteBits(1, 1) // rbsp_stop_one_bit
+
+	s, err := ParseSPS(w.Bytes())
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if s.ProfileName() != "High" || s.Level() != 4 || s.Width != 1920 || s.Height != 1080 {
+		t.Errorf("should be High 4.0, 1920x1080, but got %s %.1f, %dx%d", s.ProfileName(), s.Level(), s.Width, s.Height)
+	}
+	if fps := s.FrameRate(); fps < 29.97 || fps > 29.98 {
+		t.Errorf("should be 29.97 fps, but got %f", fps)
+	}
+	if s.SARWidth != 1 || s.SARHeight != 1 || !s.FullRange || !s.FixedFrameRate {
+		t.Errorf("should be 1:1 SAR with the full range, but got %#v", s)
+	}
+
+	if _, err = ParseSPS(w.Bytes()[:10]); err == nil {
+		t.Errorf("should be error for the truncated SPS")
+	}
+	if _, err = ParseSPS(testPPS); err == nil {
+		t.Errorf("should be error for the PPS")
+	}
+}
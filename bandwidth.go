@@ -0,0 +1,131 @@
+package rtmp
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	bandwidthCheckPayloadSize = 32 * 1024
+	bandwidthCheckMaxBursts   = 32
+	bandwidthCheckDuration    = 2 * time.Second
+	bandwidthCheckTimeout     = 10 * time.Second
+)
+
+var errBandwidthNotMeasured = errors.New("bandwidth cannot be measured within the latency")
+
+// Bandwidth is the result of the bandwidth detection, which is also reported to the client with onBWDone.
+type Bandwidth struct {
+	KbitDown  float64       // The measured bandwidth from the server to the client in kbps.
+	DeltaDown float64       // The amount of the payloads sent to the client in kbit.
+	DeltaTime time.Duration // The time to send the payloads, excluding a round trip of the latency for each round.
+	Latency   time.Duration // The round-trip time of an onBWCheck call without a payload.
+}
+
+func randomPayload(size int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	var sb strings.Builder
+	sb.Grow(size)
+	for i := 0; i < size; i++ {
+		sb.WriteByte(letters[rand.Intn(len(letters))])
+	}
+	return sb.String()
+}
+
+// CheckBandwidth runs the bandwidth detection of Flash Media Server. It measures the latency with an
+// onBWCheck call, invokes onBWCheck with payload bursts until bandwidthCheckDuration elapses, and
+// reports the measured bandwidth to the client with onBWDone. The bursts of a round are pipelined,
+// so that the time to transfer them is the time of the round excluding a round trip. Rounds are
+// repeated until the transfer time is longer than the latency.
+//
+// Like Call, CheckBandwidth must not be called from the goroutine which handles the connection.
+func (c *Conn) CheckBandwidth(ctx context.Context) (*Bandwidth, error) {
+	start := time.Now()
+	if _, err := c.Call(ctx, "onBWCheck"); err != nil {
+		return nil, err
+	}
+	latency := time.Since(start)
+
+	payload := randomPayload(bandwidthCheckPayloadSize)
+	var sent int
+	var transfer time.Duration
+	start = time.Now()
+	for bursts := 1; ; bursts *= 2 {
+		elapsed := time.Since(start)
+		if transfer > latency && (bursts > bandwidthCheckMaxBursts || elapsed >= bandwidthCheckDuration) {
+			break
+		}
+		if elapsed >= bandwidthCheckTimeout {
+			return nil, errBandwidthNotMeasured
+		}
+		if bursts > bandwidthCheckMaxBursts {
+			bursts = bandwidthCheckMaxBursts
+		}
+		roundStart := time.Now()
+		if err := c.sendBursts(ctx, payload, bursts); err != nil {
+			return nil, err
+		}
+		// The round which is shorter than the latency is not measured, since its transfer time is
+		// hidden by the jitter of the latency.
+		if t := time.Since(roundStart) - latency; t > 0 {
+			sent += bursts * len(payload)
+			transfer += t
+		}
+	}
+
+	bw := &Bandwidth{
+		DeltaDown: float64(sent) * 8 / 1000,
+		DeltaTime: transfer,
+		Latency:   latency,
+	}
+	bw.KbitDown = bw.DeltaDown / bw.DeltaTime.Seconds()
+
+	err := c.notify("onBWDone", bw.KbitDown, bw.DeltaDown, float64(bw.DeltaTime.Milliseconds()), float64(bw.Latency.Milliseconds()))
+	if err != nil {
+		return nil, err
+	}
+	return bw, nil
+}
+
+// sendBursts invokes onBWCheck with the payload n times without waiting for each result,
+// and returns when all of them are returned.
+func (c *Conn) sendBursts(ctx context.Context, payload string, n int) error {
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := c.Call(ctx, "onBWCheck", payload)
+			errs <- err
+		}()
+	}
+	var err error
+	for i := 0; i < n; i++ {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// detectBandwidth runs CheckBandwidth and reports the result to OnBandwidth. It runs once per
+// connection, since detections at the same time measure the payloads of each other.
+func (c *Conn) detectBandwidth() {
+	c.bandwidthOnce.Do(c.reportBandwidth)
+}
+
+func (c *Conn) reportBandwidth() {
+	ctx, cancel := context.WithTimeout(context.Background(), bandwidthCheckTimeout)
+	defer cancel()
+
+	bw, err := c.CheckBandwidth(ctx)
+	if err != nil {
+		c.server.logf("Failed to check bandwidth: %s", err)
+		return
+	}
+	c.server.logf("Bandwidth: %.0f kbps (latency: %s)", bw.KbitDown, bw.Latency)
+	if c.server.OnBandwidth != nil {
+		c.server.OnBandwidth(c, bw)
+	}
+}
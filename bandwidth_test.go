@@ -0,0 +1,101 @@
+package rtmp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zhangpeihao/goamf"
+)
+
+// respondBandwidthCheck returns the results of onBWCheck calls from the server, and sends the
+// arguments of onBWDone to done.
+func respondBandwidthCheck(client net.Conn, done chan<- []interface{}) {
+	br := bufio.NewReader(client)
+	chunkStreams := make(map[uint32]*chunkStream)
+	for {
+		m, err := readChunk(br, chunkStreams, defaultChunkSize)
+		if err != nil {
+			return
+		}
+		if m == nil {
+			continue
+		}
+		buf := bytes.NewBuffer(m.payload)
+		name, _ := amf.ReadString(buf)
+		transactionID, _ := amf.ReadDouble(buf)
+		amf.ReadValue(buf)
+		if name == "onBWDone" {
+			var args []interface{}
+			for buf.Len() > 0 {
+				v, _ := amf.ReadValue(buf)
+				args = append(args, v)
+			}
+			done <- args
+			continue
+		}
+
+		res := &CallCommand{Name: "_result", TransactionID: transactionID}
+		payload := res.Bytes()
+		x, _ := genChunks(&ChunkHeader{
+			BasicHeader: &BasicHeader{FMT: 0, ChunkStreamID: 3},
+			MessageHeader: &MessageHeader{
+				MessageLength: uint32(len(payload)),
+				MessageTypeID: 20,
+			},
+		}, payload, defaultChunkSize)
+		client.Write(x)
+	}
+}
+
+func TestCheckBandwidth(t *testing.T) {
+	c, client := newConnectedTestConn()
+	defer client.Close()
+
+	done := make(chan []interface{}, 1)
+	go respondBandwidthCheck(client, done)
+
+	bw, err := c.CheckBandwidth(context.Background())
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if bw.KbitDown <= 0 {
+		t.Errorf("KbitDown should be positive, but got %f", bw.KbitDown)
+	}
+	if bw.DeltaTime <= 0 || bw.KbitDown != bw.DeltaDown/bw.DeltaTime.Seconds() {
+		t.Errorf("KbitDown should be measured in the positive time, but got %f kbit in %s", bw.DeltaDown, bw.DeltaTime)
+	}
+	args := <-done
+	if len(args) != 4 || args[0] != bw.KbitDown {
+		t.Errorf("onBWDone should be called with %f, but got %#v", bw.KbitDown, args)
+	}
+}
+
+func TestDetectBandwidthOnce(t *testing.T) {
+	c, client := newConnectedTestConn()
+	defer client.Close()
+	results := make(chan *Bandwidth, 2)
+	c.server.OnBandwidth = func(c *Conn, bw *Bandwidth) {
+		results <- bw
+	}
+
+	done := make(chan []interface{}, 2)
+	go respondBandwidthCheck(client, done)
+
+	// The detection requested while another one is running is ignored.
+	go c.detectBandwidth()
+	c.detectBandwidth()
+	c.detectBandwidth()
+	select {
+	case <-results:
+	case <-time.After(bandwidthCheckTimeout):
+		t.Fatalf("bandwidth should be detected")
+	}
+	<-done
+	if len(results) != 0 || len(done) != 0 {
+		t.Errorf("bandwidth should be detected once, but got %d more results", len(results))
+	}
+}
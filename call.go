@@ -0,0 +1,217 @@
+package rtmp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/zhangpeihao/goamf"
+)
+
+var errNotConnected = errors.New("connection is not connected")
+
+// A CallError is returned by Call when the client responds with an _error command message.
+type CallError struct {
+	// Values are the values following the transaction ID in the _error command message.
+	Values []interface{}
+}
+
+func (e *CallError) Error() string {
+	for _, v := range e.Values {
+		if info, ok := v.(amf.Object); ok {
+			if description, ok := info["description"]; ok {
+				return fmt.Sprintf("%v: %v", info["code"], description)
+			}
+			return fmt.Sprintf("%v", info["code"])
+		}
+	}
+	return fmt.Sprintf("call failed: %v", e.Values)
+}
+
+type callResponse struct {
+	values []interface{}
+	err    error
+}
+
+// Call invokes the method of the client, like onBWDone or application defined methods,
+// and waits for the _result or _error command message which has the same transaction ID.
+// It returns the values following the command object in the _result command message.
+//
+// Call must not be called from the goroutine which handles the connection, such as
+// handlers of NetConnection.call methods, since responses are read by the goroutine.
+func (c *Conn) Call(ctx context.Context, method string, args ...interface{}) ([]interface{}, error) {
+	ch := make(chan *callResponse, 1)
+	transactionID, err := c.addCall(ch)
+	if err != nil {
+		return nil, err
+	}
+	defer c.removeCall(transactionID)
+
+	cmd := &CallCommand{
+		Name:          method,
+		TransactionID: transactionID,
+		Arguments:     args,
+	}
+	err = c.writeCommand(0, cmd.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case res := <-ch:
+		return res.values, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// notify invokes the method of the client with a transaction ID of 0, which means that
+// no response is expected.
+func (c *Conn) notify(method string, args ...interface{}) error {
+	cmd := &CallCommand{
+		Name:      method,
+		Arguments: args,
+	}
+	return c.writeCommand(0, cmd.Bytes())
+}
+
+func (c *Conn) addCall(ch chan *callResponse) (float64, error) {
+	c.callMu.Lock()
+	defer c.callMu.Unlock()
+
+	// calls is initialized when the connection is connected, and is reset when it is closed.
+	if c.calls == nil {
+		return 0, errNotConnected
+	}
+	c.lastTransactionID++
+	c.calls[c.lastTransactionID] = ch
+	return c.lastTransactionID, nil
+}
+
+func (c *Conn) removeCall(transactionID float64) {
+	c.callMu.Lock()
+	defer c.callMu.Unlock()
+	delete(c.calls, transactionID)
+}
+
+// handleCallResponse resolves the call which has the transaction ID with the _result
+// or _error command message.
+func (c *Conn) handleCallResponse(commandName string, transactionID float64, buf *bytes.Buffer) error {
+	c.callMu.Lock()
+	ch, ok := c.calls[transactionID]
+	delete(c.calls, transactionID)
+	c.callMu.Unlock()
+	if !ok {
+		c.server.logf("Catch %s command message for unknown transaction (transactionID: %f)", commandName, transactionID)
+		return nil
+	}
+
+	var values []interface{}
+	for buf.Len() > 0 {
+		v, err := amf.ReadValue(buf)
+		if err != nil {
+			ch <- &callResponse{err: err}
+			return nil
+		}
+		values = append(values, v)
+	}
+
+	if commandName == "_error" {
+		ch <- &callResponse{err: &CallError{Values: values}}
+		return nil
+	}
+	// Skip the command object.
+	if len(values) > 0 {
+		values = values[1:]
+	}
+	ch <- &callResponse{values: values}
+	return nil
+}
+
+// closeCalls makes the pending calls fail, since no response arrives after the connection is closed.
+func (c *Conn) closeCalls() {
+	c.callMu.Lock()
+	defer c.callMu.Unlock()
+
+	for transactionID, ch := range c.calls {
+		ch <- &callResponse{err: errNotConnected}
+		delete(c.calls, transactionID)
+	}
+	c.calls = nil
+}
+
+// A CallHandlerFunc handles a method which the client invokes with NetConnection.call.
+// It receives the arguments following the command object. The returned value is sent
+// to the client as a _result command message, and the returned error is sent as an
+// _error command message.
+//
+// Handlers are called from the goroutine which handles the connection,
+// so they must not wait for the response of Call.
+type CallHandlerFunc func(c *Conn, args ...interface{}) (interface{}, error)
+
+// HandleCall registers the handler for the method invoked by NetConnection.call.
+// Commands defined by RTMP, like connect or publish, cannot be handled by handlers.
+func (srv *Server) HandleCall(method string, handler CallHandlerFunc) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if method == "" {
+		panic("rtmp: invalid method name")
+	}
+	if handler == nil {
+		panic("rtmp: nil handler")
+	}
+	if _, exist := srv.callHandlers[method]; exist {
+		panic("rtmp: multiple registrations for " + method)
+	}
+	if srv.callHandlers == nil {
+		srv.callHandlers = make(map[string]CallHandlerFunc)
+	}
+	srv.callHandlers[method] = handler
+}
+
+func (srv *Server) callHandler(method string) (CallHandlerFunc, bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	handler, ok := srv.callHandlers[method]
+	return handler, ok
+}
+
+// serveCall calls the handler with the arguments of the command message, and responds
+// with the returned value.
+func (c *Conn) serveCall(handler CallHandlerFunc, streamID uint32, transactionID float64, buf *bytes.Buffer) error {
+	var args []interface{}
+	for buf.Len() > 0 {
+		v, err := amf.ReadValue(buf)
+		if err != nil {
+			return &commandError{
+				code:        CodeNetConnectionCallFailed,
+				description: fmt.Sprintf("Failed to decode arguments: %s", err),
+			}
+		}
+		args = append(args, v)
+	}
+	// Skip the command object.
+	if len(args) > 0 {
+		args = args[1:]
+	}
+
+	result, err := handler(c, args...)
+	if err != nil {
+		return &commandError{
+			code:        CodeNetConnectionCallFailed,
+			description: err.Error(),
+		}
+	}
+	// A transaction ID of 0 means that the client does not expect a response.
+	if transactionID == 0 {
+		return nil
+	}
+	cmd := &CallCommand{
+		Name:          "_result",
+		TransactionID: transactionID,
+		Arguments:     []interface{}{result},
+	}
+	return c.writeCommand(streamID, cmd.Bytes())
+}
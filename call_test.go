@@ -0,0 +1,182 @@
+package rtmp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/zhangpeihao/goamf"
+)
+
+func newConnectedTestConn() (*Conn, net.Conn) {
+	return newConnectedTestConnOf(&Server{})
+}
+
+// newConnectedTestConnOf returns a connection of the server, which is connected to the returned client side.
+func newConnectedTestConnOf(srv *Server) (*Conn, net.Conn) {
+	serverSide, clientSide := net.Pipe()
+	c := srv.newConn(serverSide)
+	c.state = StateConnectResponseSent
+	c.calls = make(map[float64]chan *callResponse)
+	go func() {
+		for {
+			m, err := c.readMessage()
+			if err != nil {
+				return
+			}
+			c.handleMessage(m)
+		}
+	}()
+	return c, clientSide
+}
+
+func TestCall(t *testing.T) {
+	c, client := newConnectedTestConn()
+	defer client.Close()
+
+	go func() {
+		br := bufio.NewReader(client)
+		m, err := readChunk(br, make(map[uint32]*chunkStream), defaultChunkSize)
+		if err != nil {
+			t.Errorf("should be nil, but got %s", err)
+			return
+		}
+		buf := bytes.NewBuffer(m.payload)
+		name, _ := amf.ReadString(buf)
+		transactionID, _ := amf.ReadDouble(buf)
+		amf.ReadValue(buf)
+		arg, _ := amf.ReadValue(buf)
+		if name != "add" || arg != float64(1) {
+			t.Errorf("should be add(1), but got %s(%#v)", name, arg)
+		}
+
+		res := &CallCommand{
+			Name:          "_result",
+			TransactionID: transactionID,
+			Arguments:     []interface{}{2},
+		}
+		payload := res.Bytes()
+		x, _ := genChunks(&ChunkHeader{
+			BasicHeader: &BasicHeader{FMT: 0, ChunkStreamID: 3},
+			MessageHeader: &MessageHeader{
+				MessageLength: uint32(len(payload)),
+				MessageTypeID: 20,
+			},
+		}, payload, defaultChunkSize)
+		client.Write(x)
+	}()
+
+	values, err := c.Call(context.Background(), "add", 1)
+	if err != nil {
+		t.Errorf("should be nil, but got %s", err)
+	}
+	if len(values) != 1 || values[0] != float64(2) {
+		t.Errorf("should be [2], but got %#v", values)
+	}
+}
+
+func TestCallCanceled(t *testing.T) {
+	c, client := newConnectedTestConn()
+	defer client.Close()
+	go bufio.NewReader(client).WriteTo(new(bytes.Buffer))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Call(ctx, "add", 1); err != context.Canceled {
+		t.Errorf("should be %s, but got %v", context.Canceled, err)
+	}
+	if len(c.calls) != 0 {
+		t.Errorf("the canceled call should be removed, but got %#v", c.calls)
+	}
+}
+
+func TestHandleCall(t *testing.T) {
+	c, client := newConnectedTestConn()
+	defer client.Close()
+	c.server.HandleCall("add", func(c *Conn, args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, errors.New("add requires 2 arguments")
+		}
+		return args[0].(float64) + args[1].(float64), nil
+	})
+
+	tests := []struct {
+		arguments []interface{}
+		expected  string
+	}{
+		{arguments: []interface{}{1, 2}, expected: "_result"},
+		{arguments: []interface{}{1}, expected: "_error"},
+	}
+	br := bufio.NewReader(client)
+	chunkStreams := make(map[uint32]*chunkStream)
+	for i, tt := range tests {
+		cmd := &CallCommand{
+			Name:          "add",
+			TransactionID: float64(i + 1),
+			Arguments:     tt.arguments,
+		}
+		payload := cmd.Bytes()
+		x, _ := genChunks(&ChunkHeader{
+			BasicHeader: &BasicHeader{FMT: 0, ChunkStreamID: 3},
+			MessageHeader: &MessageHeader{
+				MessageLength: uint32(len(payload)),
+				MessageTypeID: 20,
+			},
+		}, payload, defaultChunkSize)
+		go client.Write(x)
+
+		m, err := readChunk(br, chunkStreams, defaultChunkSize)
+		if err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+		buf := bytes.NewBuffer(m.payload)
+		name, _ := amf.ReadString(buf)
+		transactionID, _ := amf.ReadDouble(buf)
+		if name != tt.expected || transactionID != float64(i+1) {
+			t.Errorf("should be %s (transactionID: %d), but got %s (transactionID: %f)", tt.expected, i+1, name, transactionID)
+		}
+	}
+}
+
+func TestHandleCallAMF3(t *testing.T) {
+	c, client := newConnectedTestConn()
+	defer client.Close()
+	c.objectEncoding = amf.AMF3
+	c.server.HandleCall("echo", func(c *Conn, args ...interface{}) (interface{}, error) {
+		return args[0], nil
+	})
+
+	cmd := &CallCommand{
+		Name:          "echo",
+		TransactionID: 1,
+		Arguments:     []interface{}{"hello"},
+	}
+	payload := append([]byte{0x00}, cmd.Bytes()...)
+	x, _ := genChunks(&ChunkHeader{
+		BasicHeader: &BasicHeader{FMT: 0, ChunkStreamID: 3},
+		MessageHeader: &MessageHeader{
+			MessageLength: uint32(len(payload)),
+			MessageTypeID: 17,
+		},
+	}, payload, defaultChunkSize)
+	go client.Write(x)
+
+	m, err := readChunk(bufio.NewReader(client), make(map[uint32]*chunkStream), defaultChunkSize)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if m.typeID != MessageCommandAMF3 || m.payload[0] != 0x00 {
+		t.Errorf("should be an AMF3 command message, but got %#v", m)
+	}
+	buf := bytes.NewBuffer(m.payload[1:])
+	name, _ := amf.ReadString(buf)
+	amf.ReadDouble(buf)
+	amf.ReadValue(buf)
+	result, _ := amf.ReadValue(buf)
+	if name != "_result" || result != "hello" {
+		t.Errorf("should be _result of hello, but got %s of %#v", name, result)
+	}
+}
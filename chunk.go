@@ -10,8 +10,147 @@ import (
 var (
 	errUnknownFMT           = errors.New("unknown fmt")
 	errInvalidChunkStreamID = errors.New("invalid chunk stream id")
+	errUnknownChunkStream   = errors.New("the first chunk of a chunk stream should have a full message header")
 )
 
+const defaultChunkSize = 128
+
+// Chunk stream IDs used by the server.
+const (
+	chunkStreamIDControl = 2
+	chunkStreamIDCommand = 3
+	chunkStreamIDAudio   = 4
+	chunkStreamIDData    = 5
+	chunkStreamIDVideo   = 6
+)
+
+// A message is a RTMP message which is reassembled from one or more chunks.
+type message struct {
+	chunkStreamID uint32
+	timestamp     uint32
+	typeID        MessageType
+	streamID      uint32
+	payload       []byte
+}
+
+// A chunkStream holds the state of a chunk stream, which is used to fill the fields omitted
+// from compressed (type 1, 2 and 3) chunk headers and to reassemble messages from chunks.
+type chunkStream struct {
+	header    MessageHeader
+	timestamp uint32
+	delta     uint32
+	extended  bool
+	payload   []byte
+}
+
+// readChunk reads a chunk and appends it to the chunk stream which it belongs to.
+// It returns a message when the message is completed by the chunk.
+func readChunk(br *bufio.Reader, chunkStreams map[uint32]*chunkStream, chunkSize uint32) (*message, error) {
+	ch, err := readChunkHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	csid := ch.BasicHeader.ChunkStreamID
+	cs, ok := chunkStreams[csid]
+	if !ok {
+		if ch.BasicHeader.FMT != 0 {
+			return nil, errUnknownChunkStream
+		}
+		cs = new(chunkStream)
+		chunkStreams[csid] = cs
+	}
+
+	mh := ch.MessageHeader
+	switch ch.BasicHeader.FMT {
+	case 0:
+		cs.header = *mh
+		cs.extended = mh.Timestamp == 16777215
+		cs.timestamp = mh.Timestamp
+		if cs.extended {
+			cs.timestamp = ch.ExtendedTimestamp
+		}
+		// A type 3 chunk following a type 0 chunk uses the timestamp as a delta.
+		cs.delta = cs.timestamp
+		cs.payload = nil
+	case 1, 2:
+		if ch.BasicHeader.FMT == 1 {
+			cs.header.MessageLength = mh.MessageLength
+			cs.header.MessageTypeID = mh.MessageTypeID
+		}
+		cs.extended = mh.TimestampDelta == 16777215
+		cs.delta = mh.TimestampDelta
+		if cs.extended {
+			cs.delta = ch.ExtendedTimestamp
+		}
+		cs.timestamp += cs.delta
+		cs.payload = nil
+	case 3:
+		if cs.extended {
+			x := make([]byte, 4)
+			if _, err := io.ReadAtLeast(br, x, 4); err != nil {
+				return nil, err
+			}
+		}
+		if len(cs.payload) == 0 {
+			cs.timestamp += cs.delta
+		}
+	}
+
+	remain := cs.header.MessageLength - uint32(len(cs.payload))
+	if remain > chunkSize {
+		remain = chunkSize
+	}
+	x := make([]byte, remain)
+	if _, err := io.ReadAtLeast(br, x, int(remain)); err != nil {
+		return nil, err
+	}
+	cs.payload = append(cs.payload, x...)
+	if uint32(len(cs.payload)) < cs.header.MessageLength {
+		return nil, nil
+	}
+
+	m := &message{
+		chunkStreamID: csid,
+		timestamp:     cs.timestamp,
+		typeID:        MessageType(cs.header.MessageTypeID),
+		streamID:      cs.header.MessageStreamID,
+		payload:       cs.payload,
+	}
+	cs.payload = nil
+	return m, nil
+}
+
+// genChunks splits the message into chunks of chunkSize bytes.
+// The first chunk has the given header, and the rest have type 3 headers.
+func genChunks(ch *ChunkHeader, payload []byte, chunkSize uint32) ([]byte, error) {
+	header, err := genChunkHeader(ch)
+	if err != nil {
+		return []byte{}, err
+	}
+	continuation, err := genBasicHeader(&BasicHeader{FMT: 3, ChunkStreamID: ch.BasicHeader.ChunkStreamID})
+	if err != nil {
+		return []byte{}, err
+	}
+	if ch.MessageHeader.Timestamp >= 16777215 {
+		// Type 3 chunks repeat the extended timestamp field.
+		continuation = append(continuation, header[len(header)-4:]...)
+	}
+
+	x := append([]byte{}, header...)
+	for len(payload) > 0 {
+		n := uint32(len(payload))
+		if n > chunkSize {
+			n = chunkSize
+		}
+		x = append(x, payload[:n]...)
+		payload = payload[n:]
+		if len(payload) > 0 {
+			x = append(x, continuation...)
+		}
+	}
+	return x, nil
+}
+
 // Chunk Header
 
 type ChunkHeader struct {
@@ -243,7 +382,7 @@ func readMessageHeader(br *bufio.Reader, fmt uint8) (*MessageHeader, error) {
 		if err != nil {
 			return nil, err
 		}
-		mh.TimestampDelta = binary.BigEndian.Uint32(x)
+		mh.TimestampDelta = binary.BigEndian.Uint32(append([]byte{0x0}, x...))
 		return mh, nil
 	case 3:
 		return mh, nil
@@ -128,3 +128,71 @@ func TestGenerateChunkHeader(t *testing.T) {
 		t.Errorf("Should be %#v, but got %#v", actual, expected)
 	}
 }
+
+func TestReadMessageHeaderType2(t *testing.T) {
+	header := []byte{0x00, 0x00, 0x21}
+	in := bufio.NewReader(bytes.NewBuffer(header))
+	actual, err := readMessageHeader(in, 2)
+	if err != nil {
+		t.Errorf("Should be nil, but got %s", err)
+	}
+	if actual.TimestampDelta != 33 {
+		t.Errorf("Should be 33, but got %d", actual.TimestampDelta)
+	}
+}
+
+func TestGenChunksAndReadChunk(t *testing.T) {
+	payload := make([]byte, 300)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	ch := &ChunkHeader{
+		BasicHeader: &BasicHeader{
+			FMT:           0,
+			ChunkStreamID: 6,
+		},
+		MessageHeader: &MessageHeader{
+			Timestamp:       1000,
+			MessageLength:   uint32(len(payload)),
+			MessageTypeID:   9,
+			MessageStreamID: 1,
+		},
+	}
+	x, err := genChunks(ch, payload, 128)
+	if err != nil {
+		t.Errorf("Should be nil, but got %s", err)
+	}
+	// 12 bytes of type 0 header and two 1 byte type 3 headers.
+	if len(x) != 12+300+2 {
+		t.Errorf("Should be %d, but got %d", 12+300+2, len(x))
+	}
+
+	// A following message which has a type 2 header inherits the length, type and stream id.
+	x = append(x, 0x86, 0x00, 0x00, 0x21)
+	x = append(x, payload[:128]...)
+	x = append(x, 0xc6)
+	x = append(x, payload[128:256]...)
+	x = append(x, 0xc6)
+	x = append(x, payload[256:]...)
+
+	in := bufio.NewReader(bytes.NewBuffer(x))
+	chunkStreams := make(map[uint32]*chunkStream)
+	var messages []*message
+	for len(messages) < 2 {
+		m, err := readChunk(in, chunkStreams, 128)
+		if err != nil {
+			t.Fatalf("Should be nil, but got %s", err)
+		}
+		if m != nil {
+			messages = append(messages, m)
+		}
+	}
+
+	expected := []*message{
+		{chunkStreamID: 6, timestamp: 1000, typeID: MessageVideo, streamID: 1, payload: payload},
+		{chunkStreamID: 6, timestamp: 1033, typeID: MessageVideo, streamID: 1, payload: payload},
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("Should be %#v, but got %#v", expected, messages)
+	}
+}
@@ -3,7 +3,6 @@ package rtmp
 import (
 	"bytes"
 	"fmt"
-	"math"
 
 	"github.com/zhangpeihao/goamf"
 )
@@ -19,6 +18,27 @@ const (
 	CodeNetConnectNetworkChange             = "NetConnection.Connect.NetworkChange"
 	CodeNetConnectRejected                  = "NetConnection.Connect.Rejected"
 	CodeNetConnectSuccess                   = "NetConnection.Connect.Success"
+	CodeNetConnectionCallFailed             = "NetConnection.Call.Failed"
+
+	CodeNetStreamFailed              = "NetStream.Failed"
+	CodeNetStreamPublishStart        = "NetStream.Publish.Start"
+	CodeNetStreamPublishBadName      = "NetStream.Publish.BadName"
+	CodeNetStreamUnpublishSuccess    = "NetStream.Unpublish.Success"
+	CodeNetStreamRecordStart         = "NetStream.Record.Start"
+	CodeNetStreamRecordStop          = "NetStream.Record.Stop"
+	CodeNetStreamRecordNoAccess      = "NetStream.Record.NoAccess"
+	CodeNetStreamRecordFailed        = "NetStream.Record.Failed"
+	CodeNetStreamPlayReset           = "NetStream.Play.Reset"
+	CodeNetStreamPlayStart           = "NetStream.Play.Start"
+	CodeNetStreamPlayPublishNotify   = "NetStream.Play.PublishNotify"
+	CodeNetStreamPlayUnpublishNotify = "NetStream.Play.UnpublishNotify"
+	CodeNetStreamPlayStop            = "NetStream.Play.Stop"
+	CodeNetStreamPlayComplete        = "NetStream.Play.Complete"
+	CodeNetStreamPlayStreamNotFound  = "NetStream.Play.StreamNotFound"
+	CodeNetStreamPauseNotify         = "NetStream.Pause.Notify"
+	CodeNetStreamUnpauseNotify       = "NetStream.Unpause.Notify"
+	CodeNetStreamSeekNotify          = "NetStream.Seek.Notify"
+	CodeNetStreamSeekFailed          = "NetStream.Seek.Failed"
 )
 
 type CommandLevel string
@@ -28,6 +48,88 @@ const (
 	CommandLevelError               = "error"
 )
 
+// A commandError is an error while handling a command message, which is sent to the client
+// as an _error response, or as an onStatus command for NetStream commands. The connection is
+// closed after the response if the error is fatal.
+type commandError struct {
+	code        CommandCode
+	description string
+	fatal       bool
+}
+
+func (e *commandError) Error() string {
+	return fmt.Sprintf("%s: %s", e.code, e.description)
+}
+
+// netStreamCommands are the commands sent by NetStream. Their errors are sent as onStatus on
+// the stream, since NetStream does not receive _error responses.
+var netStreamCommands = map[string]bool{
+	"closeStream":  true,
+	"publish":      true,
+	"play":         true,
+	"pause":        true,
+	"pauseRaw":     true,
+	"receiveAudio": true,
+	"receiveVideo": true,
+	"seek":         true,
+}
+
+func errInvalidArguments(commandName string) error {
+	var code CommandCode = CodeNetConnectionCallFailed
+	if netStreamCommands[commandName] {
+		code = CodeNetStreamFailed
+	}
+	return &commandError{
+		code:        code,
+		description: fmt.Sprintf("Invalid arguments for %s command.", commandName),
+	}
+}
+
+// readStreamNameArgument reads the arguments of commands like publish and play,
+// which are a null command object followed by a stream name.
+func readStreamNameArgument(commandName string, buf *bytes.Buffer) (string, error) {
+	if _, err := amf.ReadValue(buf); err != nil { // Returns null-type
+		return "", errInvalidArguments(commandName)
+	}
+	return readStringArgument(commandName, buf)
+}
+
+// readStringArgument, readNumberArgument and readBooleanArgument read an argument of the command
+// with amf.ReadValue, since AMF3 command messages may switch to AMF3 with an avmplus-object-marker.
+func readStringArgument(commandName string, buf *bytes.Buffer) (string, error) {
+	v, err := amf.ReadValue(buf)
+	if s, ok := v.(string); ok && err == nil {
+		return s, nil
+	}
+	return "", errInvalidArguments(commandName)
+}
+
+func readNumberArgument(commandName string, buf *bytes.Buffer) (float64, error) {
+	v, err := amf.ReadValue(buf)
+	if err != nil {
+		return 0, errInvalidArguments(commandName)
+	}
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case uint32:
+		// An AMF3 integer is a 29-bit signed integer.
+		if n&0x10000000 != 0 {
+			return float64(int32(n<<3) >> 3), nil
+		}
+		return float64(n), nil
+	}
+	return 0, errInvalidArguments(commandName)
+}
+
+func readBooleanArgument(commandName string, buf *bytes.Buffer) (bool, error) {
+	v, err := amf.ReadValue(buf)
+	if b, ok := v.(bool); ok && err == nil {
+		return b, nil
+	}
+	return false, errInvalidArguments(commandName)
+}
+
 type ResultCommand struct {
 	Name          string
 	TransactionID float64
@@ -39,13 +141,35 @@ func (rc *ResultCommand) Bytes() []byte {
 	buf := new(bytes.Buffer)
 	amf.WriteValue(buf, rc.Name)
 	amf.WriteValue(buf, rc.TransactionID)
-	amf.WriteValue(buf, rc.Properties)
-	amf.WriteValue(buf, rc.Information)
+	writeAMF0Value(buf, rc.Properties)
+	writeAMF0Value(buf, rc.Information)
 	return buf.Bytes()
 }
 
-func GenerateConnectResult(transactionID float64) ([]byte, error) {
-	cmd := &ResultCommand{
+// genCommandMessage generates a chunk of the AMF0 command message.
+func genCommandMessage(streamID uint32, payload []byte) ([]byte, error) {
+	ch := &ChunkHeader{
+		BasicHeader: &BasicHeader{
+			FMT:           0,
+			ChunkStreamID: 3,
+		},
+		MessageHeader: &MessageHeader{
+			Timestamp:       0,
+			MessageLength:   uint32(len(payload)),
+			MessageTypeID:   20,
+			MessageStreamID: streamID,
+		},
+	}
+	header, err := genChunkHeader(ch)
+	if err != nil {
+		return []byte{}, err
+	}
+	x := append(header, payload...)
+	return x, nil
+}
+
+func newConnectResult(transactionID float64, objectEncoding uint) *ResultCommand {
+	return &ResultCommand{
 		Name:          "_result",
 		TransactionID: transactionID,
 		Properties: map[string]interface{}{
@@ -59,105 +183,130 @@ func GenerateConnectResult(transactionID float64) ([]byte, error) {
 			"data": map[string]interface{}{
 				"version": "3,5,7,7009",
 			},
-			"objectEncoding": 0,
+			"objectEncoding": objectEncoding,
 			"level":          CommandLevelStatus,
 		},
 	}
-	payload := cmd.Bytes()
+}
 
-	ch := &ChunkHeader{
-		BasicHeader: &BasicHeader{
-			FMT:           0,
-			ChunkStreamID: 3,
-		},
-		MessageHeader: &MessageHeader{
-			Timestamp:       0,
-			MessageLength:   uint32(len(payload)),
-			MessageTypeID:   20,
-			MessageStreamID: 0,
+func GenerateConnectResult(transactionID float64) ([]byte, error) {
+	cmd := newConnectResult(transactionID, amf.AMF0)
+	return genCommandMessage(0, cmd.Bytes())
+}
+
+func newErrorResponse(transactionID float64, code CommandCode, description string) *ResultCommand {
+	return &ResultCommand{
+		Name:          "_error",
+		TransactionID: transactionID,
+		Information: map[string]interface{}{
+			"level":       CommandLevelError,
+			"code":        code,
+			"description": description,
 		},
 	}
-	header, err := genChunkHeader(ch)
-	if err != nil {
-		return []byte{}, err
+}
+
+func GenerateErrorResponse(transactionID float64, streamID uint32, code CommandCode, description string) ([]byte, error) {
+	cmd := newErrorResponse(transactionID, code, description)
+	return genCommandMessage(streamID, cmd.Bytes())
+}
+
+func newOnFCPublishCommand(transactionID float64, streamName string) *CallCommand {
+	return &CallCommand{
+		Name:          "onFCPublish",
+		TransactionID: transactionID,
+		Arguments: []interface{}{
+			1,
+			map[string]interface{}{
+				"level":       "status",
+				"code":        "NetStream.Publish.Start",
+				"description": fmt.Sprintf("FCPublish to stream %s.", streamName),
+			},
+		},
 	}
-	x := append(header, payload...)
-	return x, nil
 }
 
 func GenerateOnFCPublishMessage(transactionID float64, streamName string) ([]byte, error) {
-	buf := new(bytes.Buffer)
-	amf.WriteValue(buf, "onFCPublish")
-	amf.WriteValue(buf, transactionID)
-	amf.WriteValue(buf, nil)
-	amf.WriteValue(buf, 1)
-	amf.WriteValue(buf, map[string]interface{}{
-		"level":       "status",
-		"code":        "NetStream.Publish.Start",
-		"description": fmt.Sprintf("FCPublish to stream %s.", streamName),
-	})
-	payload := buf.Bytes()
+	cmd := newOnFCPublishCommand(transactionID, streamName)
+	return genCommandMessage(0, cmd.Bytes())
+}
 
-	ch := &ChunkHeader{
-		BasicHeader: &BasicHeader{
-			FMT:           0,
-			ChunkStreamID: 3,
-		},
-		MessageHeader: &MessageHeader{
-			Timestamp:       0,
-			MessageLength:   uint32(len(payload)),
-			MessageTypeID:   20,
-			MessageStreamID: 0,
+func newOnFCUnpublishCommand(transactionID float64, streamName string) *CallCommand {
+	return &CallCommand{
+		Name:          "onFCUnpublish",
+		TransactionID: transactionID,
+		Arguments: []interface{}{
+			map[string]interface{}{
+				"level":       CommandLevelStatus,
+				"code":        CodeNetStreamUnpublishSuccess,
+				"description": fmt.Sprintf("FCUnpublish to stream %s.", streamName),
+			},
 		},
 	}
-	header, err := genChunkHeader(ch)
-	if err != nil {
-		return []byte{}, err
-	}
-	x := append(header, payload...)
-	return x, nil
+}
+
+func GenerateOnFCUnpublishMessage(transactionID float64, streamName string) ([]byte, error) {
+	cmd := newOnFCUnpublishCommand(transactionID, streamName)
+	return genCommandMessage(0, cmd.Bytes())
 }
 
 type CreateStreamCommand struct {
 	Name          string
 	TransactionID float64
+	StreamID      uint32
 	Properties    map[string]interface{}
 	Message       map[string]interface{}
 }
 
+// Bytes encodes the command. A StreamID of 0 is encoded as 1, which is the stream ID used
+// before StreamID was added.
 func (c *CreateStreamCommand) Bytes() []byte {
+	streamID := c.StreamID
+	if streamID == 0 {
+		streamID = 1
+	}
 	buf := new(bytes.Buffer)
 	amf.WriteValue(buf, c.Name)
 	amf.WriteValue(buf, c.TransactionID)
 	amf.WriteValue(buf, nil)
-	amf.WriteValue(buf, 1)
+	amf.WriteValue(buf, streamID)
 	return buf.Bytes()
 }
 
+// CreateStreamResponseMessage generates the response of createStream with the stream ID 1.
+// Use GenerateCreateStreamResponse for other stream IDs.
 func CreateStreamResponseMessage(transactionID float64) ([]byte, error) {
+	return GenerateCreateStreamResponse(transactionID, 1)
+}
+
+// GenerateCreateStreamResponse generates the response of createStream with the stream ID.
+func GenerateCreateStreamResponse(transactionID float64, streamID uint32) ([]byte, error) {
 	cmd := &CreateStreamCommand{
 		Name:          "_result",
 		TransactionID: transactionID,
+		StreamID:      streamID,
 	}
-	payload := cmd.Bytes()
-	ch := &ChunkHeader{
-		BasicHeader: &BasicHeader{
-			FMT:           0,
-			ChunkStreamID: 3,
-		},
-		MessageHeader: &MessageHeader{
-			Timestamp:       0,
-			MessageLength:   uint32(len(payload)),
-			MessageTypeID:   20,
-			MessageStreamID: 0,
-		},
-	}
-	header, err := genChunkHeader(ch)
-	if err != nil {
-		return []byte{}, err
+	return genCommandMessage(0, cmd.Bytes())
+}
+
+// A CallCommand is a command message which invokes a method of the peer, such as
+// a command sent by NetConnection.call.
+type CallCommand struct {
+	Name          string
+	TransactionID float64
+	CommandObject map[string]interface{}
+	Arguments     []interface{}
+}
+
+func (c *CallCommand) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	amf.WriteValue(buf, c.Name)
+	amf.WriteValue(buf, c.TransactionID)
+	amf.WriteValue(buf, c.CommandObject)
+	for _, arg := range c.Arguments {
+		amf.WriteValue(buf, arg)
 	}
-	x := append(header, payload...)
-	return x, nil
+	return buf.Bytes()
 }
 
 type NetStreamStatusMessage struct {
@@ -175,34 +324,39 @@ func (m *NetStreamStatusMessage) Bytes() []byte {
 	return buf.Bytes()
 }
 
+// CreateOnStatusPublishStartMessage generates NetStream.Publish.Start on the stream ID 1.
+// Use GenerateOnStatusPublishStart for other stream IDs.
 func CreateOnStatusPublishStartMessage(transactionID float64, streamName string) ([]byte, error) {
+	return GenerateOnStatusPublishStart(transactionID, 1, streamName)
+}
+
+// GenerateOnStatusPublishStart generates NetStream.Publish.Start on the stream.
+func GenerateOnStatusPublishStart(transactionID float64, streamID uint32, streamName string) ([]byte, error) {
 	cmd := &NetStreamStatusMessage{
 		Name:          "onStatus",
 		TransactionID: transactionID,
 		InfoObject: map[string]interface{}{
-			"code":        "NetStream.Publish.Start",
+			"code":        CodeNetStreamPublishStart,
 			"description": fmt.Sprintf("Publishing %s.", streamName),
 			"level":       "status",
 		},
 	}
-	payload := cmd.Bytes()
+	return genCommandMessage(streamID, cmd.Bytes())
+}
 
-	ch := &ChunkHeader{
-		BasicHeader: &BasicHeader{
-			FMT:           0,
-			ChunkStreamID: 3,
-		},
-		MessageHeader: &MessageHeader{
-			Timestamp:       0,
-			MessageLength:   uint32(len(payload)),
-			MessageTypeID:   20,
-			MessageStreamID: uint32(math.Pow(2, 4*6)),
+func newOnStatusMessage(level CommandLevel, code CommandCode, description string) *NetStreamStatusMessage {
+	return &NetStreamStatusMessage{
+		Name:          "onStatus",
+		TransactionID: 0,
+		InfoObject: map[string]interface{}{
+			"code":        code,
+			"description": description,
+			"level":       level,
 		},
 	}
-	header, err := genChunkHeader(ch)
-	if err != nil {
-		return []byte{}, err
-	}
-	x := append(header, payload...)
-	return x, nil
+}
+
+func GenerateOnStatusMessage(streamID uint32, level CommandLevel, code CommandCode, description string) ([]byte, error) {
+	cmd := newOnStatusMessage(level, code, description)
+	return genCommandMessage(streamID, cmd.Bytes())
 }
@@ -332,3 +332,142 @@ func TestReadOnStatusPublish(t *testing.T) {
 		}
 	}
 }
+
+func TestGenerateOnStatusMessage(t *testing.T) {
+	x, err := GenerateOnStatusMessage(1, CommandLevelStatus, CodeNetStreamUnpublishSuccess, "myStream is now unpublished.")
+	if err != nil {
+		t.Errorf("should be nil, but got %s", err)
+	}
+	inReader := bufio.NewReader(bytes.NewBuffer(x))
+	ch, err := readChunkHeader(inReader)
+	if err != nil {
+		t.Errorf("should be nil, but got %s", err)
+	}
+	if ch.MessageHeader.MessageStreamID != 1 {
+		t.Errorf("MessageStreamID should be 1, but got %d", ch.MessageHeader.MessageStreamID)
+	}
+
+	name, err := amf.ReadString(inReader)
+	if err != nil {
+		t.Errorf("should be nil, but got %s", err)
+	}
+	if name != "onStatus" {
+		t.Errorf("should be onStatus, but got %s", name)
+	}
+	if _, err = amf.ReadDouble(inReader); err != nil {
+		t.Errorf("should be nil, but got %s", err)
+	}
+	if _, err = amf.ReadValue(inReader); err != nil {
+		t.Errorf("should be nil, but got %s", err)
+	}
+	info, err := amf.ReadValue(inReader)
+	if err != nil {
+		t.Errorf("should be nil, but got %s", err)
+	}
+	if code := info.(amf.Object)["code"]; code != "NetStream.Unpublish.Success" {
+		t.Errorf("should be NetStream.Unpublish.Success, but got %#v", code)
+	}
+}
+
+func TestGenerateErrorResponse(t *testing.T) {
+	x, err := GenerateErrorResponse(2, 0, CodeNetConnectionCallFailed, "Method not found (foo).")
+	if err != nil {
+		t.Errorf("should be nil, but got %s", err)
+	}
+	inReader := bufio.NewReader(bytes.NewBuffer(x))
+	if _, err = readChunkHeader(inReader); err != nil {
+		t.Errorf("should be nil, but got %s", err)
+	}
+
+	var values []interface{}
+	for {
+		v, err := amf.ReadValue(inReader)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Errorf("should be nil, but got %s", err)
+		}
+		values = append(values, v)
+	}
+	if len(values) != 4 {
+		t.Fatalf("should be 4 values, but got %#v", values)
+	}
+	if values[0] != "_error" || values[1] != float64(2) || values[2] != nil {
+		t.Errorf("should be _error response with transaction ID 2, but got %#v", values)
+	}
+	info := values[3].(amf.Object)
+	if info["level"] != "error" || info["code"] != "NetConnection.Call.Failed" {
+		t.Errorf("should be an error status object, but got %#v", info)
+	}
+}
+
+func TestCreateStreamResponseMessage(t *testing.T) {
+	for _, tt := range []struct {
+		generate func() ([]byte, error)
+		streamID float64
+	}{
+		{func() ([]byte, error) { return CreateStreamResponseMessage(2) }, 1},
+		{func() ([]byte, error) { return GenerateCreateStreamResponse(2, 3) }, 3},
+	} {
+		x, err := tt.generate()
+		if err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+		inReader := bufio.NewReader(bytes.NewBuffer(x))
+		if _, err = readChunkHeader(inReader); err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+		name, _ := amf.ReadString(inReader)
+		transactionID, _ := amf.ReadDouble(inReader)
+		amf.ReadValue(inReader)
+		streamID, _ := amf.ReadDouble(inReader)
+		if name != "_result" || transactionID != 2 || streamID != tt.streamID {
+			t.Errorf("should be _result of stream %v, but got %s of stream %v", tt.streamID, name, streamID)
+		}
+	}
+}
+
+func TestCreateOnStatusPublishStartMessage(t *testing.T) {
+	for _, tt := range []struct {
+		generate func() ([]byte, error)
+		streamID uint32
+	}{
+		{func() ([]byte, error) { return CreateOnStatusPublishStartMessage(0, "myStream") }, 1},
+		{func() ([]byte, error) { return GenerateOnStatusPublishStart(0, 3, "myStream") }, 3},
+	} {
+		x, err := tt.generate()
+		if err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+		ch, err := readChunkHeader(bufio.NewReader(bytes.NewBuffer(x)))
+		if err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+		if ch.MessageHeader.MessageStreamID != tt.streamID {
+			t.Errorf("MessageStreamID should be %d, but got %d", tt.streamID, ch.MessageHeader.MessageStreamID)
+		}
+	}
+}
+
+func TestReadNumberArgument(t *testing.T) {
+	for _, tt := range []struct {
+		payload []byte
+		want    float64
+	}{
+		{[]byte{0x00, 0x3f, 0xf8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, 1.5},
+		{[]byte{0x11, 0x04, 0x05}, 5},
+		{[]byte{0x11, 0x04, 0xff, 0xff, 0xff, 0xff}, -1},
+		{[]byte{0x11, 0x05, 0xbf, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, -1},
+	} {
+		got, err := readNumberArgument("seek", bytes.NewBuffer(tt.payload))
+		if err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+		if got != tt.want {
+			t.Errorf("should be %f, but got %f", tt.want, got)
+		}
+	}
+	if _, err := readNumberArgument("seek", bytes.NewBuffer([]byte{0x11, 0x06, 0x01})); err == nil {
+		t.Errorf("should be an error for a string")
+	}
+}
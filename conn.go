@@ -5,8 +5,11 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/zhangpeihao/goamf"
 )
@@ -34,6 +37,8 @@ const (
 	// StateSentCreateStreamResponse means that server returns _result command message for createStream
 	StateSentCreateStreamResponse
 	// StatePublishingContent means that server is just receiving content.
+	//
+	// Deprecated: Since a connection can have multiple streams, publishing is tracked per stream.
 	StatePublishingContent
 )
 
@@ -58,32 +63,95 @@ const (
 )
 
 // A Conn represents the RTMP connection and implements the RTMP protocol over net.Conn interface.
-type conn struct {
-	netconn    net.Conn
-	server     *Server
-	bufr       *bufio.Reader
-	bufw       *bufio.Writer
-	readbuf    []byte
-	writebuf   []byte
-	state      ConnectionState
-	chunkSize  uint32
-	streamName string
+type Conn struct {
+	netconn        net.Conn
+	server         *Server
+	bufr           *bufio.Reader
+	bufw           *bufio.Writer
+	readbuf        []byte
+	writebuf       []byte
+	state          ConnectionState
+	chunkSize      uint32
+	chunkStreams   map[uint32]*chunkStream
+	streams        map[uint32]*netStream
+	lastStreamID   uint32
+	writeMu        sync.Mutex
+	writeChunkSize uint32
+	objectEncoding uint
+	app            string
+	tcURL          string
+	enhanced       bool
+	videoFourCCs   []FourCC
+	audioFourCCs   []FourCC
+	capsEx         uint32
+	sharedObjects  map[string]*sharedObject
+
+	callMu            sync.Mutex
+	lastTransactionID float64
+	calls             map[float64]chan *callResponse
+	bandwidthOnce     sync.Once
+
+	closed     chan struct{}
+	startTime  time.Time
+	lastActive time.Time
+	lastReadMu sync.Mutex
+	lastRead   time.Time
+	rttMu      sync.Mutex
+	rtt        time.Duration
+}
+
+// TcURL returns the tcUrl of the connect command, including its query parameters.
+func (c *Conn) TcURL() string {
+	return c.tcURL
 }
 
-func (c *conn) serve() error {
+func (c *Conn) serve() error {
+	if c.server.IdleTimeout > 0 {
+		c.netconn.SetDeadline(time.Now().Add(c.server.IdleTimeout))
+	}
 	if err := c.handshake(); err != nil {
 		c.server.logf("Handshaking Error: %s", err)
 		c.netconn.Close()
 		return err
 	}
+	c.netconn.SetDeadline(time.Time{})
 
+	defer c.close()
 	for {
-		if err := c.readChunk(); err == io.EOF {
-			c.netconn.Close()
+		c.netconn.SetReadDeadline(c.readDeadline())
+		m, err := c.readMessage()
+		if err == io.EOF {
 			return nil
+		} else if isTimeout(err) {
+			return c.timeout()
 		} else if err != nil {
 			return err
 		}
+		c.touch()
+		switch m.typeID {
+		case MessageAcknowledgement, MessageUserControl:
+		default:
+			c.lastActive = time.Now()
+		}
+		if err = c.handleMessage(m); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Conn) close() {
+	close(c.closed)
+	// The connection is closed first, so that the goroutines which are writing to the client,
+	// like the players of recorded files, do not block closing the streams.
+	c.netconn.Close()
+	c.closeCalls()
+	for name, so := range c.sharedObjects {
+		delete(c.sharedObjects, name)
+		c.server.releaseSharedObject(c, so)
+	}
+	for _, ns := range c.streams {
+		// The errors are of the status messages, which cannot be sent to the closed connection.
+		ns.close()
 	}
 }
 
@@ -119,7 +187,7 @@ func (c *conn) serve() error {
 //        |                    |                     |
 //
 
-func (c *conn) handshake() error {
+func (c *Conn) handshake() error {
 	c.server.logf("Begin RTMP Handshake.")
 
 	// << C0
@@ -192,84 +260,83 @@ func (c *conn) handshake() error {
 	return nil
 }
 
-func (c *conn) readChunk() error {
-	header, err := readChunkHeader(c.bufr)
-	if err == io.EOF {
-		c.server.logf("Got EOF")
-		return nil
-	} else if err != nil {
-		c.server.logf("Error while readChunkHeader: %s", err)
-		return err
+func (c *Conn) readMessage() (*message, error) {
+	for {
+		m, err := readChunk(c.bufr, c.chunkStreams, c.chunkSize)
+		if err == io.EOF {
+			c.server.logf("Got EOF")
+			return nil, err
+		} else if err != nil {
+			c.server.logf("Error while readChunk: %s", err)
+			return nil, err
+		}
+		if m != nil {
+			return m, nil
+		}
 	}
+}
 
-	switch MessageType(header.MessageHeader.MessageTypeID) {
+func (c *Conn) handleMessage(m *message) error {
+	switch m.typeID {
 	case MessageSetChunkSize:
 		//  0                   1                   2                   3
 		//  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
 		// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 		// |0|                   chunk size (31 bits)                      |
 		// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-		if header.MessageHeader.MessageLength != 4 {
+		if len(m.payload) != 4 {
 			return errors.New("the payload length of Set Chunk Size command should be 4")
 		}
-		payload := make([]byte, 4)
-		_, err := io.ReadAtLeast(c.bufr, payload, int(4))
-		if err != nil {
-			return err
+		chunkSize := binary.BigEndian.Uint32(m.payload) & 0x7fffffff
+		if chunkSize == 0 {
+			// No message can be read with the chunk size 0.
+			return errors.New("the chunk size of Set Chunk Size command should not be 0")
 		}
-		c.chunkSize = binary.BigEndian.Uint32(payload)
+		c.chunkSize = chunkSize
 		c.server.logf("Set Chunk Size: %d", c.chunkSize)
-		return nil
 	case MessageAbort:
 		//  0                   1                   2                   3
 		//  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
 		// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 		// |                   chunk stream id (32 bits)                   |
 		// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-		payload := make([]byte, header.MessageHeader.MessageLength)
-		_, err := io.ReadAtLeast(c.bufr, payload, int(header.MessageHeader.MessageLength))
-		if err != nil {
-			return err
+		if len(m.payload) < 4 {
+			return errors.New("the payload length of Abort Message should be 4")
+		}
+		csid := binary.BigEndian.Uint32(m.payload)
+		if cs, ok := c.chunkStreams[csid]; ok {
+			cs.payload = nil
 		}
-		csid := binary.BigEndian.Uint32(payload)
 		c.server.logf("Abort Message: %d", csid)
-		return nil
 	case MessageAcknowledgement:
 		//  0                   1                   2                   3
 		//  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
 		// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 		// |                    sequence number (4 bytes)                  |
 		// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-		payload := make([]byte, header.MessageHeader.MessageLength)
-		_, err := io.ReadAtLeast(c.bufr, payload, int(header.MessageHeader.MessageLength))
-		if err != nil {
-			return err
+		if len(m.payload) < 4 {
+			return errors.New("the payload length of Acknowledgement should be 4")
 		}
-		sequenceNumber := binary.BigEndian.Uint32(payload)
+		sequenceNumber := binary.BigEndian.Uint32(m.payload)
 		c.server.logf("Acknowledgement Message: %d", sequenceNumber)
-		return nil
 	case MessageUserControl:
-		payload := make([]byte, header.MessageHeader.MessageLength)
-		_, err := io.ReadAtLeast(c.bufr, payload, int(header.MessageHeader.MessageLength))
+		e, err := ReadUserControlEvent(m.payload)
 		if err != nil {
-			return err
+			c.server.logf("Failed to parse User Control Message: %s (payload: %#v)", err, m.payload)
+			return nil
 		}
-		c.server.logf("User Control Message\n")
-		c.server.logf("  payload : %#v\n", payload)
+		return c.handleUserControlEvent(e)
 	case MessageAcknowledgementWindowSize:
 		//  0                   1                   2                   3
 		//  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
 		// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 		// |              Acknowledgement Window size (4 bytes)            |
 		// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-		payload := make([]byte, header.MessageHeader.MessageLength)
-		_, err := io.ReadAtLeast(c.bufr, payload, int(header.MessageHeader.MessageLength))
-		if err != nil {
-			return err
+		if len(m.payload) < 4 {
+			return errors.New("the payload length of Window Acknowledgement Size should be 4")
 		}
-		ackWindowSize := binary.BigEndian.Uint32(payload)
+		ackWindowSize := binary.BigEndian.Uint32(m.payload)
 		c.server.logf("WindowAcknowledgementSize Message: %d", ackWindowSize)
-		return nil
 	case MessageSetPeerBandwidth:
 		//  0                   1                   2                   3
 		//  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
@@ -278,97 +345,50 @@ func (c *conn) readChunk() error {
 		// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 		// |  Limit Type   |
 		// +-+-+-+-+-+-+-+-+
-		payload := make([]byte, header.MessageHeader.MessageLength)
-		_, err := io.ReadAtLeast(c.bufr, payload, int(header.MessageHeader.MessageLength))
-		if err != nil {
-			return err
+		if len(m.payload) < 5 {
+			return errors.New("the payload length of Set Peer Bandwidth should be 5")
 		}
-		ackWindowSize := binary.BigEndian.Uint32(payload[:4])
-		limitType := payload[4]
+		ackWindowSize := binary.BigEndian.Uint32(m.payload[:4])
+		limitType := m.payload[4]
 		c.server.logf("SetPeerBandWidth Message: %d, %d", ackWindowSize, limitType)
-		return nil
-	case MessageAudio:
-		payload := make([]byte, header.MessageHeader.MessageLength)
-		_, err := io.ReadAtLeast(c.bufr, payload, int(header.MessageHeader.MessageLength))
-		if err != nil {
-			return err
-		}
-		c.server.logf("Catch audio message")
-	case MessageVideo:
-		payload := make([]byte, header.MessageHeader.MessageLength)
-		_, err := io.ReadAtLeast(c.bufr, payload, int(header.MessageHeader.MessageLength))
-		if err != nil {
-			return err
+	case MessageAudio, MessageVideo, MessageDataAMF0:
+		ns, ok := c.streams[m.streamID]
+		if !ok || ns.state != streamPublishing {
+			c.server.logf("Catch a message (type: %d) on stream %d which is not publishing", m.typeID, m.streamID)
+			return nil
 		}
-		c.server.logf("Catch video message")
+		ns.live.handleMessage(ns, m)
 	case MessageDataAMF3:
-		payload := make([]byte, header.MessageHeader.MessageLength)
-		_, err := io.ReadAtLeast(c.bufr, payload, int(header.MessageHeader.MessageLength))
-		if err != nil {
-			return err
-		}
 		c.server.logf("Catch DataMessage(AMF3)")
 	case MessageCommandAMF3:
-		payload := make([]byte, header.MessageHeader.MessageLength)
-		_, err := io.ReadAtLeast(c.bufr, payload, int(header.MessageHeader.MessageLength))
-		if err != nil {
-			return err
-		}
 		c.server.logf("Catch AMF3 Command Message")
+		return c.handleCommandMessage(m)
 	case MessageSharedObjectAMF3:
-		payload := make([]byte, header.MessageHeader.MessageLength)
-		_, err := io.ReadAtLeast(c.bufr, payload, int(header.MessageHeader.MessageLength))
-		if err != nil {
-			return err
-		}
-		c.server.logf("Catch SharedObjectMessage(AMF0)")
-	case MessageDataAMF0:
-		payload := make([]byte, header.MessageHeader.MessageLength)
-		_, err := io.ReadAtLeast(c.bufr, payload, int(header.MessageHeader.MessageLength))
-		if err != nil {
-			return err
-		}
-		c.server.logf("Catch DataMessage(AMF0)")
+		c.server.logf("Catch SharedObjectMessage(AMF3)")
+		return c.handleSharedObjectMessage(m)
 	case MessageCommandAMF0:
 		c.server.logf("Catch AMF0 Command Message")
-		err = c.handleCommandMessageAMF0(header)
-		if err != nil {
-			return err
-		}
+		return c.handleCommandMessage(m)
 	case MessageSharedObjectAMF0:
-		payload := make([]byte, header.MessageHeader.MessageLength)
-		_, err := io.ReadAtLeast(c.bufr, payload, int(header.MessageHeader.MessageLength))
-		if err != nil {
-			return err
-		}
 		c.server.logf("Catch SharedObjectMessage(AMF0)")
+		return c.handleSharedObjectMessage(m)
 	case MessageAggregate:
-		payload := make([]byte, header.MessageHeader.MessageLength)
-		_, err := io.ReadAtLeast(c.bufr, payload, int(header.MessageHeader.MessageLength))
-		if err != nil {
-			return err
-		}
 		c.server.logf("Catch AggregateMessage")
 	default:
-		c.server.logf("Catch unknown message type id: %d", header.MessageHeader.MessageTypeID)
-		c.server.logf("%#v", header.BasicHeader)
-		c.server.logf("%#v", header.MessageHeader)
-		payload := make([]byte, header.MessageHeader.MessageLength)
-		_, err := io.ReadAtLeast(c.bufr, payload, int(header.MessageHeader.MessageLength))
-		if err != nil {
-			return err
-		}
-		return nil
+		c.server.logf("Catch unknown message type id: %d", m.typeID)
 	}
 	return nil
 }
 
-func (c *conn) handleCommandMessageAMF0(header *ChunkHeader) error {
-	ml := header.MessageHeader.MessageLength
-	payload := make([]byte, ml)
-	_, err := io.ReadAtLeast(c.bufr, payload, int(ml))
-	if err != nil {
-		return err
+func (c *Conn) handleCommandMessage(m *message) error {
+	payload := m.payload
+	if m.typeID == MessageCommandAMF3 {
+		// An AMF3 command message starts with a format selector (0x00), which is followed
+		// by AMF0 encoded values that may switch to AMF3 with an avmplus-object-marker.
+		if len(payload) == 0 {
+			return errors.New("the payload of AMF3 command message should not be empty")
+		}
+		payload = payload[1:]
 	}
 
 	buf := bytes.NewBuffer(payload)
@@ -381,160 +401,400 @@ func (c *conn) handleCommandMessageAMF0(header *ChunkHeader) error {
 		return err
 	}
 
+	err = c.handleCommand(m.streamID, commandName, transactionID, buf)
+	if ce, ok := err.(*commandError); ok {
+		c.server.logf("Failed to handle %s command message (transactionID: %f): %s", commandName, transactionID, ce)
+		if netStreamCommands[commandName] && !ce.fatal {
+			return c.writeCommand(m.streamID, newOnStatusMessage(CommandLevelError, ce.code, ce.description).Bytes())
+		}
+		// A transaction ID of 0 means that the client does not expect a response.
+		if transactionID != 0 {
+			cmd := newErrorResponse(transactionID, ce.code, ce.description)
+			if err = c.writeCommand(m.streamID, cmd.Bytes()); err != nil {
+				return err
+			}
+		}
+		if ce.fatal {
+			return ce
+		}
+		return nil
+	}
+	return err
+}
+
+func (c *Conn) handleCommand(streamID uint32, commandName string, transactionID float64, buf *bytes.Buffer) error {
+	if commandName != "connect" && c.state < StateConnectResponseSent {
+		return &commandError{
+			code:        CodeNetConnectRejected,
+			description: fmt.Sprintf("%s command is received before connect.", commandName),
+			fatal:       true,
+		}
+	}
+
 	switch commandName {
 	case "connect":
-		// Maybe this is bug of ffmpeg(librtmp). 0xc3 is in tcp byte stream.
-		// Cause of this strange byte, the payload length does not equals with message length in Message Header.
-		for i := range payload {
-			if payload[i] == 0xc3 {
-				if _, err := c.bufr.ReadByte(); err != nil {
-					return err
-				}
-				break
+		c.server.logf("Receive connect command message (transactionID: %f).", transactionID)
+		if c.state >= StateConnectResponseSent {
+			return &commandError{
+				code:        CodeNetConnectionCallFailed,
+				description: "The connection is already connected.",
 			}
 		}
 
-		c.server.logf("Receive connect command message (transactionID: %f).", transactionID)
 		// Send window acknowledgement
 		was, err := GenerateWindowAcknowledgementSizeChunk(WindowAcknowledgementSize)
 		if err != nil {
 			return err
 		}
-		_, err = c.bufw.Write(was)
-		if err != nil {
-			return err
-		}
 
 		// Send peer bandwidth
 		pbw, err := GenerateSetPeerBandwidthChunk(PeerBandWidth, PeerBandwidthLimitTypeDynamic)
 		if err != nil {
 			return err
 		}
-		_, err = c.bufw.Write(pbw)
-		if err != nil {
-			return err
-		}
 
 		// Send User Control Message Events - StreamBegin
 		usb, err := GenerateUserStreamBegin(0)
 		if err != nil {
 			return err
 		}
-		_, err = c.bufw.Write(usb)
-		if err != nil {
-			return err
-		}
 
 		// Set Chunk Size (size = 4096)
 		scs, err := GenerateSetChunkSize(4096)
 		if err != nil {
 			return err
 		}
-		_, err = c.bufw.Write(scs)
+
+		err = c.writeChunks(was, pbw, usb, scs)
 		if err != nil {
 			return err
 		}
+		c.writeMu.Lock()
+		c.writeChunkSize = 4096
+		c.writeMu.Unlock()
 
 		// Command Message: _result (connect)
-		x, err := GenerateConnectResult(transactionID)
-		if err != nil {
-			return err
+		if v, err := amf.ReadValue(buf); err == nil {
+			if obj, ok := v.(amf.Object); ok {
+				if objectEncoding, ok := obj["objectEncoding"].(float64); ok && uint(objectEncoding) == amf.AMF3 {
+					c.objectEncoding = amf.AMF3
+				}
+				if app, ok := obj["app"].(string); ok {
+					c.app = app
+				}
+				if tcURL, ok := obj["tcUrl"].(string); ok {
+					c.tcURL = tcURL
+				}
+				c.negotiateEnhanced(obj)
+			}
 		}
-		_, err = c.bufw.Write(x)
-		if err != nil {
-			return err
+		result := newConnectResult(transactionID, c.objectEncoding)
+		for k, v := range c.enhancedConnectResultProperties() {
+			result.Properties[k] = v
 		}
-		err = c.bufw.Flush()
+		err = c.writeCommand(0, result.Bytes())
 		if err != nil {
 			return err
 		}
 		c.state = StateConnectResponseSent
+
+		c.callMu.Lock()
+		c.calls = make(map[float64]chan *callResponse)
+		c.callMu.Unlock()
+		if c.server.OnConnect != nil {
+			go c.server.OnConnect(c)
+		}
+		if c.server.DetectBandwidth {
+			go c.detectBandwidth()
+		}
+		if c.server.PingInterval > 0 {
+			go c.ping()
+		}
 	case "releaseStream":
 		c.server.logf("Receive a releaseStream command (transactionID: %f).", transactionID)
-		if c.state < StateConnectResponseSent {
-			return errors.New("connect response should be sent before receiving a releaseStream command")
-		}
-		//_, err := amf.ReadValue(buf) // Returns null-type
-		//if err != nil {
-		//	return err
-		//}
-		//streamName, err := amf.ReadString(buf) // Should return streamName (string)
-		//if err != nil {
-		//	return err
-		//}
-	case "FCPublish":
-		_, err := amf.ReadValue(buf) // Returns null-type
+		streamName, err := readStreamNameArgument(commandName, buf)
 		if err != nil {
 			return err
 		}
-		streamName, err := amf.ReadString(buf) // Should return streamName(string)
+		c.server.releaseStream(streamName, c)
+	case "FCPublish":
+		streamName, err := readStreamNameArgument(commandName, buf)
 		if err != nil {
 			return err
 		}
 		c.server.logf("Receive FCPublish command message (transactionID: %f, streamName: %s).", transactionID, streamName)
 
-		msg, err := GenerateOnFCPublishMessage(transactionID, streamName)
+		return c.writeCommand(0, newOnFCPublishCommand(transactionID, streamName).Bytes())
+	case "FCUnpublish":
+		streamName, err := readStreamNameArgument(commandName, buf)
 		if err != nil {
 			return err
 		}
-		_, err = c.bufw.Write(msg)
+		c.server.logf("Receive FCUnpublish command message (transactionID: %f, streamName: %s).", transactionID, streamName)
+
+		err = c.writeCommand(0, newOnFCUnpublishCommand(transactionID, streamName).Bytes())
 		if err != nil {
 			return err
 		}
-		err = c.bufw.Flush()
-		if err != nil {
-			return err
+		for _, ns := range c.streams {
+			if ns.state == streamPublishing && ns.name == streamName {
+				return ns.close()
+			}
 		}
-		c.streamName = streamName
 		return nil
 	case "createStream":
 		c.server.logf("Catch createStream command message - (transactionID: %f)", transactionID)
-		msg, err := CreateStreamResponseMessage(transactionID)
-		if err != nil {
+		ns := c.createStream()
+		cmd := &CreateStreamCommand{
+			Name:          "_result",
+			TransactionID: transactionID,
+			StreamID:      ns.id,
+		}
+		if err := c.writeCommand(0, cmd.Bytes()); err != nil {
 			return err
 		}
-		_, err = c.bufw.Write(msg)
+		c.state = StateSentCreateStreamResponse
+		return nil
+	case "closeStream":
+		c.server.logf("Catch closeStream command message - (transactionID: %f, streamID: %d)", transactionID, streamID)
+		ns, err := c.stream(commandName, streamID)
 		if err != nil {
 			return err
 		}
-		err = c.bufw.Flush()
+		return ns.close()
+	case "deleteStream":
+		if _, err := amf.ReadValue(buf); err != nil { // Returns null-type
+			return errInvalidArguments(commandName)
+		}
+		id, err := readNumberArgument(commandName, buf) // Should return streamID(number)
 		if err != nil {
 			return err
 		}
-		c.state = StateSentCreateStreamResponse
-		return nil
+		c.server.logf("Catch deleteStream command message - (transactionID: %f, streamID: %f)", transactionID, id)
+		return c.deleteStream(uint32(id))
 	case "publish":
-		c.server.logf("Catch publish command message - (transactionID: %f)", transactionID)
-		if c.state < StateSentCreateStreamResponse {
-			return errors.New("connect response should be sent before receiving a releaseStream command")
-		} else if c.state == StatePublishingContent {
-			c.server.logf("Catch publish command message in StateSentCreateStreamResponse")
+		c.server.logf("Catch publish command message - (transactionID: %f, streamID: %d)", transactionID, streamID)
+		ns, err := c.stream(commandName, streamID)
+		if err != nil {
+			return err
+		} else if ns.state == streamPublishing {
+			c.server.logf("Catch publish command message on the stream which is already publishing")
 			return nil
 		}
-		// returns user control message(stream begin)
-		var msg []byte
-		msg, err = GenerateUserStreamBegin(1)
+		streamName, err := readStreamNameArgument(commandName, buf) // Should return publishingName(string)
 		if err != nil {
 			return err
 		}
-		_, err = c.bufw.Write(msg)
+		publishType := publishLive
+		if buf.Len() > 0 {
+			if publishType, err = readStringArgument(commandName, buf); err != nil {
+				return err
+			}
+		}
+		if err = ns.close(); err != nil {
+			return err
+		}
+		return ns.publish(streamName, publishType)
+	case "play":
+		c.server.logf("Catch play command message - (transactionID: %f, streamID: %d)", transactionID, streamID)
+		ns, err := c.stream(commandName, streamID)
+		if err != nil {
+			return err
+		}
+		streamName, err := readStreamNameArgument(commandName, buf)
+		if err != nil {
+			return err
+		}
+		start := float64(playLiveOrRecorded)
+		if buf.Len() > 0 {
+			if start, err = readNumberArgument(commandName, buf); err != nil {
+				return err
+			}
+		}
+		if err = ns.close(); err != nil {
+			return err
+		}
+		return ns.play(streamName, start)
+	case "pause", "pauseRaw":
+		ns, err := c.stream(commandName, streamID)
+		if err != nil {
+			return err
+		}
+		if _, err = amf.ReadValue(buf); err != nil { // Returns null-type
+			return errInvalidArguments(commandName)
+		}
+		pause, err := readBooleanArgument(commandName, buf)
+		if err != nil {
+			return err
+		}
+		return ns.pause(pause)
+	case "receiveAudio", "receiveVideo":
+		ns, err := c.stream(commandName, streamID)
 		if err != nil {
 			return err
 		}
-		msg, err = CreateOnStatusPublishStartMessage(transactionID, c.streamName)
+		if _, err = amf.ReadValue(buf); err != nil { // Returns null-type
+			return errInvalidArguments(commandName)
+		}
+		receive, err := readBooleanArgument(commandName, buf)
 		if err != nil {
 			return err
 		}
-		_, err = c.bufw.Write(msg)
+		if commandName == "receiveAudio" {
+			ns.receiveAudio(receive)
+		} else {
+			ns.receiveVideo(receive)
+		}
+	case "seek":
+		ns, err := c.stream(commandName, streamID)
 		if err != nil {
 			return err
 		}
+		if _, err = amf.ReadValue(buf); err != nil { // Returns null-type
+			return errInvalidArguments(commandName)
+		}
+		position, err := readNumberArgument(commandName, buf)
+		if err != nil {
+			return err
+		}
+		return ns.seek(position)
+	case "_result", "_error":
+		return c.handleCallResponse(commandName, transactionID, buf)
+	case "checkBandwidth", "_checkbw":
+		// The detection calls methods of the client, so it cannot run on this goroutine.
+		go c.detectBandwidth()
+		if transactionID == 0 {
+			return nil
+		}
+		cmd := &CallCommand{
+			Name:          "_result",
+			TransactionID: transactionID,
+			Arguments:     []interface{}{nil},
+		}
+		return c.writeCommand(streamID, cmd.Bytes())
+	case "onStatus":
+		c.server.logf("Catch onStatus command message - (transactionID: %f, streamID: %d)", transactionID, streamID)
+	default:
+		if handler, ok := c.server.callHandler(commandName); ok {
+			return c.serveCall(handler, streamID, transactionID, buf)
+		}
+		return &commandError{
+			code:        CodeNetConnectionCallFailed,
+			description: fmt.Sprintf("Method not found (%s).", commandName),
+		}
+	}
+	return nil
+}
 
-		err = c.bufw.Flush()
+func (c *Conn) handleUserControlEvent(e *UserControlEvent) error {
+	switch e.Type {
+	case UserControlSetBufferLength:
+		c.server.logf("SetBufferLength Event: %d (streamID: %d)", e.BufferLength, e.StreamID)
+		if ns, ok := c.streams[e.StreamID]; ok {
+			ns.setBufferLength(e.BufferLength)
+		}
+	case UserControlPingResponse:
+		c.handlePingResponse(e.Timestamp)
+	case UserControlPingRequest:
+		x, err := GenerateUserPingResponse(e.Timestamp)
 		if err != nil {
 			return err
 		}
-		c.state = StatePublishingContent
+		if err = c.writeChunks(x); err != nil {
+			return err
+		}
+	default:
+		c.server.logf("User Control Event: %d", e.Type)
+	}
+	if c.server.OnUserControl != nil {
+		c.server.OnUserControl(c, e)
 	}
 	return nil
 }
+
+// stream returns the stream which the command is sent on.
+func (c *Conn) stream(commandName string, streamID uint32) (*netStream, error) {
+	ns, ok := c.streams[streamID]
+	if !ok {
+		return nil, &commandError{
+			code:        CodeNetStreamFailed,
+			description: fmt.Sprintf("%s command is received on stream %d which is not created.", commandName, streamID),
+		}
+	}
+	return ns, nil
+}
+
+// createStream allocates a new message stream ID, which is unique in the connection.
+func (c *Conn) createStream() *netStream {
+	for {
+		c.lastStreamID++
+		if _, ok := c.streams[c.lastStreamID]; !ok && c.lastStreamID != 0 {
+			break
+		}
+	}
+	ns := &netStream{
+		id:   c.lastStreamID,
+		conn: c,
+	}
+	c.streams[ns.id] = ns
+	return ns
+}
+
+func (c *Conn) deleteStream(streamID uint32) error {
+	ns, ok := c.streams[streamID]
+	if !ok {
+		return nil
+	}
+	delete(c.streams, streamID)
+	return ns.close()
+}
+
+// writeChunks writes chunks to the connection and flushes them.
+// It is safe to call from other connections, for example to relay messages to players.
+func (c *Conn) writeChunks(chunks ...[]byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	for _, x := range chunks {
+		if _, err := c.bufw.Write(x); err != nil {
+			return err
+		}
+	}
+	return c.bufw.Flush()
+}
+
+// writeCommand writes a command message in the object encoding which the client negotiated on connect.
+// Values of AMF3 command messages are encoded in AMF0, which is allowed by the format selector 0x00.
+func (c *Conn) writeCommand(streamID uint32, payload []byte) error {
+	if c.objectEncoding == amf.AMF3 {
+		return c.writeMessage(chunkStreamIDCommand, MessageCommandAMF3, streamID, 0, append([]byte{0x00}, payload...))
+	}
+	return c.writeMessage(chunkStreamIDCommand, MessageCommandAMF0, streamID, 0, payload)
+}
+
+// writeMessage splits the message into chunks and writes them to the connection.
+func (c *Conn) writeMessage(csid uint32, typeID MessageType, streamID, timestamp uint32, payload []byte) error {
+	ch := &ChunkHeader{
+		BasicHeader: &BasicHeader{
+			FMT:           0,
+			ChunkStreamID: csid,
+		},
+		MessageHeader: &MessageHeader{
+			Timestamp:       timestamp,
+			MessageLength:   uint32(len(payload)),
+			MessageTypeID:   uint8(typeID),
+			MessageStreamID: streamID,
+		},
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	x, err := genChunks(ch, payload, c.writeChunkSize)
+	if err != nil {
+		return err
+	}
+	if _, err = c.bufw.Write(x); err != nil {
+		return err
+	}
+	return c.bufw.Flush()
+}
@@ -0,0 +1,379 @@
+package rtmp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zhangpeihao/goamf"
+)
+
+// A pipeClient is the client side of a connection made by newConnectedTestConnOf.
+// Messages from the server are read in the background, so that the server is never blocked by the test.
+type pipeClient struct {
+	t        *testing.T
+	conn     net.Conn
+	messages chan *message
+}
+
+func newPipeClient(t *testing.T, conn net.Conn) *pipeClient {
+	c := &pipeClient{t: t, conn: conn, messages: make(chan *message, 64)}
+	go func() {
+		defer close(c.messages)
+		br := bufio.NewReader(conn)
+		chunkStreams := make(map[uint32]*chunkStream)
+		chunkSize := uint32(defaultChunkSize)
+		for {
+			m, err := readChunk(br, chunkStreams, chunkSize)
+			if err != nil {
+				return
+			}
+			if m == nil {
+				continue
+			}
+			if m.typeID == MessageSetChunkSize {
+				chunkSize = binary.BigEndian.Uint32(m.payload)
+			}
+			c.messages <- m
+		}
+	}()
+	return c
+}
+
+func (c *pipeClient) send(typeID MessageType, streamID, timestamp uint32, payload []byte) {
+	x, _ := genChunks(&ChunkHeader{
+		BasicHeader: &BasicHeader{FMT: 0, ChunkStreamID: chunkStreamIDCommand},
+		MessageHeader: &MessageHeader{
+			Timestamp:       timestamp,
+			MessageLength:   uint32(len(payload)),
+			MessageTypeID:   uint8(typeID),
+			MessageStreamID: streamID,
+		},
+	}, payload, defaultChunkSize)
+	if _, err := c.conn.Write(x); err != nil {
+		c.t.Fatalf("should be nil, but got %s", err)
+	}
+}
+
+// command sends an AMF0 command message of the values on the stream.
+func (c *pipeClient) command(streamID uint32, values ...interface{}) {
+	buf := new(bytes.Buffer)
+	for _, v := range values {
+		amf.WriteValue(buf, v)
+	}
+	c.send(MessageCommandAMF0, streamID, 0, buf.Bytes())
+}
+
+// read returns the next message of the type from the server, skipping messages of other types.
+func (c *pipeClient) read(typeID MessageType) *message {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case m, ok := <-c.messages:
+			if !ok {
+				c.t.Fatalf("connection is closed while waiting for a message (type: %d)", typeID)
+			}
+			if m.typeID == typeID {
+				return m
+			}
+		case <-timeout:
+			c.t.Fatalf("timed out while waiting for a message (type: %d)", typeID)
+		}
+	}
+}
+
+// readCommand returns the next command message from the server and its values.
+func (c *pipeClient) readCommand() (*message, []interface{}) {
+	m := c.read(MessageCommandAMF0)
+	var values []interface{}
+	buf := bytes.NewBuffer(m.payload)
+	for buf.Len() > 0 {
+		v, err := amf.ReadValue(buf)
+		if err != nil {
+			c.t.Fatalf("should be nil, but got %s", err)
+		}
+		values = append(values, v)
+	}
+	return m, values
+}
+
+// readStatus returns the code of the next onStatus command and the stream which it is sent on.
+func (c *pipeClient) readStatus() (uint32, string) {
+	m, values := c.readCommand()
+	if len(values) != 4 || values[0] != "onStatus" {
+		c.t.Fatalf("should be onStatus, but got %#v", values)
+	}
+	info, _ := values[3].(amf.Object)
+	code, _ := info["code"].(string)
+	return m.streamID, code
+}
+
+// createStream creates a stream and returns its ID.
+func (c *pipeClient) createStream(transactionID float64) uint32 {
+	c.command(0, "createStream", transactionID, nil)
+	_, values := c.readCommand()
+	if len(values) != 4 || values[0] != "_result" || values[1] != transactionID {
+		c.t.Fatalf("should be _result of createStream, but got %#v", values)
+	}
+	return uint32(values[3].(float64))
+}
+
+func (c *pipeClient) expectStatus(streamID uint32, code string) {
+	id, got := c.readStatus()
+	if id != streamID || got != code {
+		c.t.Fatalf("should be %s on stream %d, but got %s on stream %d", code, streamID, got, id)
+	}
+}
+
+func TestUnpublishCommands(t *testing.T) {
+	srv := &Server{}
+	_, pubConn := newConnectedTestConnOf(srv)
+	defer pubConn.Close()
+	_, playConn := newConnectedTestConnOf(srv)
+	defer playConn.Close()
+	pub := newPipeClient(t, pubConn)
+	player := newPipeClient(t, playConn)
+
+	playID := player.createStream(1)
+	player.command(playID, "play", 0, nil, "cam")
+	player.expectStatus(playID, CodeNetStreamPlayReset)
+	player.expectStatus(playID, CodeNetStreamPlayStart)
+
+	for _, name := range []string{"closeStream", "deleteStream", "FCUnpublish"} {
+		id := pub.createStream(1)
+		pub.command(id, "publish", 0, nil, "cam", "live")
+		pub.expectStatus(id, CodeNetStreamPublishStart)
+		player.expectStatus(playID, CodeNetStreamPlayPublishNotify)
+
+		switch name {
+		case "closeStream":
+			pub.command(id, "closeStream", 0, nil)
+		case "deleteStream":
+			pub.command(0, "deleteStream", 0, nil, float64(id))
+		case "FCUnpublish":
+			pub.command(0, "FCUnpublish", 0, nil, "cam")
+			if _, values := pub.readCommand(); values[0] != "onFCUnpublish" {
+				t.Fatalf("should be onFCUnpublish, but got %#v", values)
+			}
+		}
+		pub.expectStatus(id, CodeNetStreamUnpublishSuccess)
+		player.expectStatus(playID, CodeNetStreamPlayUnpublishNotify)
+		if srv.isPublished("", "cam") {
+			t.Errorf("%s should release the stream name", name)
+		}
+	}
+}
+
+func TestMultipleStreams(t *testing.T) {
+	srv := &Server{}
+	_, pubConn := newConnectedTestConnOf(srv)
+	defer pubConn.Close()
+	_, playConn := newConnectedTestConnOf(srv)
+	defer playConn.Close()
+	pub := newPipeClient(t, pubConn)
+	player := newPipeClient(t, playConn)
+
+	names := []string{"cam1", "cam2"}
+	var pubIDs, playIDs []uint32
+	for i, name := range names {
+		id := player.createStream(float64(i + 1))
+		player.command(id, "play", 0, nil, name)
+		player.expectStatus(id, CodeNetStreamPlayReset)
+		player.expectStatus(id, CodeNetStreamPlayStart)
+		playIDs = append(playIDs, id)
+	}
+	for i, name := range names {
+		id := pub.createStream(float64(i + 1))
+		pub.command(id, "publish", 0, nil, name, "live")
+		pub.expectStatus(id, CodeNetStreamPublishStart)
+		player.expectStatus(playIDs[i], CodeNetStreamPlayPublishNotify)
+		pubIDs = append(pubIDs, id)
+	}
+	if pubIDs[0] == pubIDs[1] || playIDs[0] == playIDs[1] {
+		t.Fatalf("stream IDs should be unique, but got %v and %v", pubIDs, playIDs)
+	}
+
+	// Each stream relays its own media to the player of the stream.
+	for i, id := range pubIDs {
+		pub.send(MessageVideo, id, 0, []byte{0x17, 0x01, 0x00, 0x00, 0x00, byte(i)})
+		m := player.read(MessageVideo)
+		if m.streamID != playIDs[i] || m.payload[5] != byte(i) {
+			t.Errorf("should be the video of %s on stream %d, but got %d on stream %d", names[i], playIDs[i], m.payload[5], m.streamID)
+		}
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	_, conn := newConnectedTestConn()
+	defer conn.Close()
+	client := newPipeClient(t, conn)
+
+	client.command(0, "foo", 2, nil)
+	_, values := client.readCommand()
+	if len(values) != 4 || values[0] != "_error" || values[1] != float64(2) {
+		t.Fatalf("should be _error with transaction ID 2, but got %#v", values)
+	}
+	if info, _ := values[3].(amf.Object); info["code"] != CodeNetConnectionCallFailed || info["level"] != CommandLevelError {
+		t.Errorf("should be NetConnection.Call.Failed, but got %#v", values[3])
+	}
+
+	// Nothing is sent for a transaction ID of 0, so the next command is the result of createStream.
+	client.command(0, "foo", 0, nil)
+	client.createStream(3)
+}
+
+func TestNetStreamCommandError(t *testing.T) {
+	_, conn := newConnectedTestConn()
+	defer conn.Close()
+	client := newPipeClient(t, conn)
+
+	// NetStream commands are answered with onStatus on the stream, regardless of the transaction ID.
+	client.command(5, "play", 1, nil, "cam")
+	client.expectStatus(5, CodeNetStreamFailed)
+
+	id := client.createStream(2)
+	client.command(id, "publish", 0, nil)
+	client.expectStatus(id, CodeNetStreamFailed)
+}
+
+// readMedia returns the next audio or video message from the server.
+func (c *pipeClient) readMedia() *message {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case m, ok := <-c.messages:
+			if !ok {
+				c.t.Fatalf("connection is closed while waiting for media")
+			}
+			if m.typeID == MessageAudio || m.typeID == MessageVideo {
+				return m
+			}
+		case <-timeout:
+			c.t.Fatalf("timed out while waiting for media")
+		}
+	}
+}
+
+// startLive publishes the stream on pub and plays it on player, and returns the IDs of the streams.
+func startLive(t *testing.T, pub, player *pipeClient, name string) (uint32, uint32) {
+	playID := player.createStream(1)
+	player.command(playID, "play", 0, nil, name)
+	player.expectStatus(playID, CodeNetStreamPlayReset)
+	player.expectStatus(playID, CodeNetStreamPlayStart)
+	pubID := pub.createStream(1)
+	pub.command(pubID, "publish", 0, nil, name, "live")
+	pub.expectStatus(pubID, CodeNetStreamPublishStart)
+	player.expectStatus(playID, CodeNetStreamPlayPublishNotify)
+	return pubID, playID
+}
+
+func TestReceiveAudioVideo(t *testing.T) {
+	srv := &Server{}
+	_, pubConn := newConnectedTestConnOf(srv)
+	defer pubConn.Close()
+	_, playConn := newConnectedTestConnOf(srv)
+	defer playConn.Close()
+	pub := newPipeClient(t, pubConn)
+	player := newPipeClient(t, playConn)
+	pubID, playID := startLive(t, pub, player, "cam")
+
+	audio := []byte{0xaf, 0x01, 0x21}
+	keyframe := []byte{0x17, 0x01, 0x00, 0x00, 0x00}
+	interframe := []byte{0x27, 0x01, 0x00, 0x00, 0x00}
+
+	player.command(playID, "receiveAudio", 0, nil, false)
+	// The result of createStream makes sure that the command above is handled.
+	player.createStream(2)
+	pub.send(MessageAudio, pubID, 0, audio)
+	pub.send(MessageVideo, pubID, 0, keyframe)
+	if m := player.readMedia(); m.typeID != MessageVideo {
+		t.Errorf("audio should not be delivered, but got a message (type: %d)", m.typeID)
+	}
+
+	player.command(playID, "receiveAudio", 0, nil, true)
+	player.command(playID, "receiveVideo", 0, nil, false)
+	player.createStream(3)
+	pub.send(MessageVideo, pubID, 40, keyframe)
+	pub.send(MessageAudio, pubID, 40, audio)
+	if m := player.readMedia(); m.typeID != MessageAudio {
+		t.Errorf("video should not be delivered, but got a message (type: %d)", m.typeID)
+	}
+
+	// Video is resumed from the next keyframe.
+	player.command(playID, "receiveVideo", 0, nil, true)
+	player.createStream(4)
+	pub.send(MessageVideo, pubID, 80, interframe)
+	pub.send(MessageVideo, pubID, 120, keyframe)
+	if m := player.readMedia(); m.typeID != MessageVideo || m.payload[0] != 0x17 {
+		t.Errorf("should be the keyframe, but got %#v", m)
+	}
+}
+
+func TestPauseLive(t *testing.T) {
+	srv := &Server{}
+	_, pubConn := newConnectedTestConnOf(srv)
+	defer pubConn.Close()
+	_, playConn := newConnectedTestConnOf(srv)
+	defer playConn.Close()
+	pub := newPipeClient(t, pubConn)
+	player := newPipeClient(t, playConn)
+	pubID, playID := startLive(t, pub, player, "cam")
+
+	player.command(playID, "pause", 0, nil, true, 0)
+	player.expectStatus(playID, CodeNetStreamPauseNotify)
+	pub.send(MessageVideo, pubID, 0, []byte{0x17, 0x01, 0x00, 0x00, 0x00, 1})
+
+	// The live stream is resumed from the next keyframe.
+	player.command(playID, "pause", 0, nil, false, 0)
+	player.expectStatus(playID, CodeNetStreamUnpauseNotify)
+	pub.send(MessageVideo, pubID, 40, []byte{0x27, 0x01, 0x00, 0x00, 0x00, 2})
+	pub.send(MessageVideo, pubID, 80, []byte{0x17, 0x01, 0x00, 0x00, 0x00, 3})
+	if m := player.readMedia(); m.payload[5] != 3 {
+		t.Errorf("should be the keyframe after unpausing, but got %d", m.payload[5])
+	}
+}
+
+func TestSetChunkSize(t *testing.T) {
+	c := (&Server{}).newConn(nil)
+	if err := c.handleMessage(&message{typeID: MessageSetChunkSize, payload: []byte{0x00, 0x00, 0x10, 0x00}}); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if c.chunkSize != 4096 {
+		t.Errorf("should be 4096, but got %d", c.chunkSize)
+	}
+	// The chunk size 0 is a protocol error, since no message can be read with it.
+	if err := c.handleMessage(&message{typeID: MessageSetChunkSize, payload: []byte{0x80, 0x00, 0x00, 0x00}}); err == nil {
+		t.Errorf("should be an error")
+	}
+	if c.chunkSize != 4096 {
+		t.Errorf("should be 4096, but got %d", c.chunkSize)
+	}
+}
+
+func TestAMF3CommandArguments(t *testing.T) {
+	_, conn := newConnectedTestConn()
+	defer conn.Close()
+	client := newPipeClient(t, conn)
+	id := client.createStream(1)
+
+	// The arguments of an AMF3 command message are switched to AMF3 with an avmplus-object-marker.
+	buf := bytes.NewBuffer([]byte{0x00})
+	amf.WriteValue(buf, "publish")
+	amf.WriteValue(buf, 0.0)
+	amf.WriteValue(buf, nil)
+	buf.Write([]byte{0x11, 0x06, 0x07, 'c', 'a', 'm'})
+	buf.Write([]byte{0x11, 0x06, 0x09, 'l', 'i', 'v', 'e'})
+	client.send(MessageCommandAMF3, id, 0, buf.Bytes())
+	client.expectStatus(id, CodeNetStreamPublishStart)
+
+	buf = bytes.NewBuffer([]byte{0x00})
+	amf.WriteValue(buf, "deleteStream")
+	amf.WriteValue(buf, 0.0)
+	amf.WriteValue(buf, nil)
+	buf.Write([]byte{0x11, 0x04, byte(id)})
+	client.send(MessageCommandAMF3, 0, 0, buf.Bytes())
+	client.expectStatus(id, CodeNetStreamUnpublishSuccess)
+}
@@ -0,0 +1,534 @@
+package rtmp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dvrTimeFormat is the format of {start} in the path of recordings.
+const dvrTimeFormat = "20060102-150405"
+
+var (
+	errStreamNotPublished = errors.New("stream is not published")
+	errRecordingDisabled  = errors.New("recording is disabled for the application")
+	errAlreadyRecording   = errors.New("stream is already recorded")
+	errNotRecording       = errors.New("stream is not recorded")
+)
+
+// A DVRPolicy is the policy to record the live streams of an application.
+type DVRPolicy struct {
+	// Path is the template of the file path like Server.DVRPath. If empty, streams are not recorded.
+	// It should have {start} or {index} if the recording is rotated, which starts from 0. Existing files
+	// are not overwritten, and a suffix like "-1" is added before the extension instead.
+	Path string
+
+	// MaxDuration and MaxSize, if not zero, rotate the recording to a new file on the first keyframe
+	// after the file reaches the duration or the size in bytes. Recordings without video are rotated
+	// on any audio message. Each file begins with the metadata and the sequence headers.
+	MaxDuration time.Duration
+	MaxSize     int64
+
+	// Manual disables recording streams when they are published, which are recorded only with StartRecording.
+	Manual bool
+}
+
+// path returns the path of the FLV file, in which the placeholders of Path are replaced.
+func (p *DVRPolicy) path(app, name string, start time.Time, index int) string {
+	r := strings.NewReplacer(
+		"{app}", cleanPathElement(app),
+		"{name}", cleanPathElement(name),
+		"{start}", start.Format(dvrTimeFormat),
+		"{index}", strconv.Itoa(index),
+	)
+	return r.Replace(p.Path)
+}
+
+// A Recording is a file recorded from a live stream, which is completed.
+type Recording struct {
+	App  string
+	Name string
+	Path string
+	// Start is the time when the file started.
+	Start    time.Time
+	Duration time.Duration
+	Size     int64
+}
+
+// A dvrFile is an FLV file of a recording.
+type dvrFile struct {
+	path     string
+	start    time.Time
+	file     *flvFile
+	recorder *streamRecorder
+
+	hasAudio bool
+	hasVideo bool
+	// appended is true if the file existed before, and the recording is appended to it.
+	appended bool
+}
+
+// createDVRFile creates the FLV file of a recording. Unless overwrite is true, the existing file is kept,
+// and a suffix like "-1" is added before the extension of the new file. It happens when the path
+// template has neither {start} nor {index}, or the stream is published again in the same second.
+func createDVRFile(path string, start time.Time, overwrite bool) (*dvrFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	var f *flvFile
+	var err error
+	if overwrite {
+		f, err = createFLVFile(path)
+	} else {
+		ext := filepath.Ext(path)
+		base := strings.TrimSuffix(path, ext)
+		for i := 1; ; i++ {
+			if f, err = createNewFLVFile(path); !os.IsExist(err) {
+				break
+			}
+			path = fmt.Sprintf("%s-%d%s", base, i, ext)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dvrFile{
+		path:     path,
+		start:    start,
+		file:     f,
+		recorder: &streamRecorder{file: f},
+	}, nil
+}
+
+// openDVRFile opens the FLV file to append the recording to it, which is continued from its last timestamp.
+func openDVRFile(path string, start time.Time) (*dvrFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	_, err := os.Stat(path)
+	exists := err == nil
+	f, err := openFLVFile(path)
+	if err != nil {
+		return nil, err
+	}
+	df := &dvrFile{
+		path:     path,
+		start:    start,
+		file:     f,
+		recorder: &streamRecorder{file: f, offset: f.lastTimestamp},
+		appended: exists,
+	}
+	// The flags are kept for the tags recorded before.
+	if exists {
+		if df.hasAudio, df.hasVideo, err = f.readFlags(); err != nil {
+			f.close()
+			return nil, err
+		}
+	}
+	return df, nil
+}
+
+func (f *dvrFile) write(m *message) error {
+	if err := f.recorder.write(m); err != nil {
+		return err
+	}
+	switch m.typeID {
+	case MessageAudio:
+		f.hasAudio = true
+	case MessageVideo:
+		f.hasVideo = true
+	}
+	return nil
+}
+
+// writeHeaders writes the metadata and the sequence headers at the timestamp, which begin the file.
+func (f *dvrFile) writeHeaders(headers []*message, timestamp uint32) error {
+	for _, h := range headers {
+		if err := f.write(&message{typeID: h.typeID, timestamp: timestamp, payload: h.payload}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// empty reports whether the file has no tags.
+func (f *dvrFile) empty() bool {
+	return f.file.size <= flvHeaderSize+4
+}
+
+// duration returns the timestamp of the last tag, since the file starts from 0.
+func (f *dvrFile) duration() time.Duration {
+	return time.Duration(f.file.lastTimestamp) * time.Millisecond
+}
+
+// close finalizes the FLV file. The flags of the FLV header are updated to tell which tags are present,
+// and the file is made seekable with finalizeFLV.
+func (f *dvrFile) close() error {
+	if err := f.file.writeFlags(f.hasAudio, f.hasVideo); err != nil {
+		f.file.close()
+		return err
+	}
+	if err := f.file.close(); err != nil {
+		return err
+	}
+	return finalizeFLV(f.path)
+}
+
+// discard closes the file of the recording which is aborted before it is started. The new file is
+// removed, and the appended file is finalized with the tags recorded before.
+func (f *dvrFile) discard() error {
+	if f.appended {
+		return f.close()
+	}
+	f.file.close()
+	return os.Remove(f.path)
+}
+
+// A dvrRecorder is a subscriber which records a live stream to FLV files while it is published.
+type dvrRecorder struct {
+	ls     *liveStream
+	app    string
+	policy DVRPolicy
+	index  int
+	file   *dvrFile
+	// publisher, if not nil, is notified of the recording with onStatus. It is set for the record
+	// and append publishing types.
+	publisher *netStream
+
+	// waitKeyframe drops messages until the message which can begin the file, when the recording
+	// is started while the stream is published.
+	waitKeyframe bool
+	// err is the error while writing, after which the recording is stopped.
+	err error
+}
+
+func newDVRRecorder(ls *liveStream, app string, policy DVRPolicy) (*dvrRecorder, error) {
+	now := time.Now()
+	f, err := createDVRFile(policy.path(app, ls.name, now, 0), now, false)
+	if err != nil {
+		return nil, err
+	}
+	return &dvrRecorder{ls: ls, app: app, policy: policy, file: f}, nil
+}
+
+// newRecordRecorder returns the recorder for the record and append publishing types, which records
+// the stream published by ns to the file of the path without rotation.
+func newRecordRecorder(ns *netStream, path string, appending bool) (*dvrRecorder, error) {
+	// The file of the previous recording is reopened after it is finalized.
+	ns.conn.server.waitFinalized(path)
+	var f *dvrFile
+	var err error
+	if appending {
+		f, err = openDVRFile(path, time.Now())
+	} else {
+		f, err = createDVRFile(path, time.Now(), true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dvrRecorder{
+		ls:        ns.live,
+		app:       ns.conn.app,
+		policy:    DVRPolicy{Path: path},
+		file:      f,
+		publisher: ns,
+	}, nil
+}
+
+func (r *dvrRecorder) accept(m *message) bool {
+	return r.err == nil
+}
+
+func (r *dvrRecorder) writeMedia(m *message) error {
+	if err := r.write(m); err != nil {
+		r.err = err
+		if r.publisher != nil {
+			r.publisher.writeStatus(CommandLevelError, CodeNetStreamRecordFailed, fmt.Sprintf("Failed to record %s.", r.ls.name))
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *dvrRecorder) write(m *message) error {
+	if r.waitKeyframe {
+		if !isRecordingBoundary(m, r.ls.videoSequenceHeaders != nil) {
+			return nil
+		}
+		if err := r.file.writeHeaders(r.ls.headers(), m.timestamp); err != nil {
+			return err
+		}
+		r.waitKeyframe = false
+	} else if r.shouldRotate(m) {
+		if err := r.rotate(m); err != nil {
+			return err
+		}
+	}
+	return r.file.write(m)
+}
+
+func (r *dvrRecorder) writeStatus(level CommandLevel, code CommandCode, description string) error {
+	return nil
+}
+
+// shouldRotate reports whether the file reaches the limits of the policy, and the message can begin a new file.
+func (r *dvrRecorder) shouldRotate(m *message) bool {
+	f := r.file
+	if !f.recorder.started {
+		return false
+	}
+	var elapsed time.Duration
+	if m.timestamp > f.recorder.base {
+		elapsed = time.Duration(m.timestamp-f.recorder.base) * time.Millisecond
+	}
+	if !(r.policy.MaxDuration > 0 && elapsed >= r.policy.MaxDuration) &&
+		!(r.policy.MaxSize > 0 && f.file.size >= r.policy.MaxSize) {
+		return false
+	}
+	return isRecordingBoundary(m, f.hasVideo)
+}
+
+// isRecordingBoundary reports whether the message can begin a file, which is a keyframe,
+// or any audio message if the stream has no video.
+func isRecordingBoundary(m *message, hasVideo bool) bool {
+	switch m.typeID {
+	case MessageAudio:
+		return !hasVideo
+	case MessageVideo:
+		p, err := ReadVideoPacket(m.timestamp, m.payload)
+		return err == nil && p.IsKeyframe() && !p.IsSequenceHeader()
+	}
+	return false
+}
+
+// rotate starts a new file with the headers of the stream, and finalizes the current file in the background.
+// ls.mu must be held.
+func (r *dvrRecorder) rotate(m *message) error {
+	now := time.Now()
+	f, err := createDVRFile(r.policy.path(r.app, r.ls.name, now, r.index+1), now, false)
+	if err != nil {
+		return err
+	}
+	if err = f.writeHeaders(r.ls.headers(), m.timestamp); err != nil {
+		f.discard()
+		return err
+	}
+	old := r.file
+	r.file = f
+	r.index++
+	r.ls.server.finalizeDVRFile(r.app, r.ls.name, old)
+	return nil
+}
+
+// cleanPathElement cleans the name used in a file path, so that it does not point outside the directory.
+func cleanPathElement(name string) string {
+	return filepath.Clean("/" + name)[1:]
+}
+
+// dvrPolicy returns the recording policy of the application.
+func (srv *Server) dvrPolicy(app string) DVRPolicy {
+	if p, ok := srv.DVRPolicies[app]; ok {
+		return p
+	}
+	return DVRPolicy{Path: srv.DVRPath}
+}
+
+// startDVR starts recording the live stream published by ns, if the policy of the application has the path.
+func (srv *Server) startDVR(ls *liveStream, ns *netStream) {
+	policy := srv.dvrPolicy(ns.conn.app)
+	if policy.Path == "" || policy.Manual || ns.recordsToRecordDir() {
+		return
+	}
+	dvr, err := newDVRRecorder(ls, ns.conn.app, policy)
+	if err != nil {
+		srv.logf("Failed to record %s: %s", ls.name, err)
+		return
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.publisher != ns {
+		// The publisher was kicked while opening the file.
+		dvr.file.discard()
+		return
+	}
+	ls.dvr = dvr
+	ls.subscribers[dvr] = struct{}{}
+	srv.logf("Recording %s to %s", ls.name, dvr.file.path)
+}
+
+// stopDVR removes the recorder of the stream from the subscribers, which is closed by the caller
+// with closeDVR after releasing the locks. ls.mu must be held.
+func (ls *liveStream) stopDVR() *dvrRecorder {
+	dvr := ls.dvr
+	if dvr != nil {
+		delete(ls.subscribers, dvr)
+		ls.dvr = nil
+	}
+	return dvr
+}
+
+// closeDVR stops the recording of the stream, and finalizes the file in the background. dvr can be nil.
+func (srv *Server) closeDVR(name string, dvr *dvrRecorder) {
+	if dvr == nil {
+		return
+	}
+	if dvr.err != nil {
+		srv.logf("Stopped recording %s to %s: %s", name, dvr.file.path, dvr.err)
+	}
+	srv.finalizeDVRFile(dvr.app, name, dvr.file)
+	if dvr.publisher != nil && dvr.err == nil {
+		err := dvr.publisher.writeStatus(CommandLevelStatus, CodeNetStreamRecordStop, fmt.Sprintf("Stopped recording %s.", name))
+		if err != nil {
+			srv.logf("Failed to notify %s of %s: %s", CodeNetStreamRecordStop, name, err)
+		}
+	}
+}
+
+// finalizeDVRFile runs closeDVRFile in a new goroutine, since finalizing rewrites the whole file.
+// The file can be opened again after waitFinalized.
+func (srv *Server) finalizeDVRFile(app, name string, f *dvrFile) {
+	srv.mu.Lock()
+	if srv.finalizing == nil {
+		srv.finalizing = make(map[string]chan struct{})
+	}
+	prev := srv.finalizing[f.path]
+	done := make(chan struct{})
+	srv.finalizing[f.path] = done
+	srv.mu.Unlock()
+
+	go func() {
+		if prev != nil {
+			<-prev
+		}
+		srv.closeDVRFile(app, name, f)
+		srv.mu.Lock()
+		if srv.finalizing[f.path] == done {
+			delete(srv.finalizing, f.path)
+		}
+		srv.mu.Unlock()
+		close(done)
+	}()
+}
+
+// waitFinalized waits until the recording of the path is finalized.
+func (srv *Server) waitFinalized(path string) {
+	srv.mu.Lock()
+	done := srv.finalizing[path]
+	srv.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// closeDVRFile finalizes the file of the recording, and calls OnRecording. The file without tags is
+// removed instead, which is left when the recording is stopped before the first keyframe.
+func (srv *Server) closeDVRFile(app, name string, f *dvrFile) {
+	if f.empty() {
+		f.file.close()
+		if err := os.Remove(f.path); err != nil {
+			srv.logf("Failed to remove the empty recording of %s to %s: %s", name, f.path, err)
+		} else {
+			srv.logf("Removed the empty recording of %s to %s", name, f.path)
+		}
+		return
+	}
+	if err := f.close(); err != nil {
+		srv.logf("Failed to finalize the recording of %s to %s: %s", name, f.path, err)
+		return
+	}
+	srv.logf("Recorded %s to %s", name, f.path)
+	if srv.OnRecording == nil {
+		return
+	}
+	rec := &Recording{
+		App:      app,
+		Name:     name,
+		Path:     f.path,
+		Start:    f.start,
+		Duration: f.duration(),
+	}
+	if info, err := os.Stat(f.path); err == nil {
+		rec.Size = info.Size()
+	}
+	srv.OnRecording(rec)
+}
+
+// StartRecording starts recording the live stream of the application with its policy, even if the policy is Manual.
+// The file begins with the GOP cache if it is available, or otherwise with the next keyframe, so that it is decodable.
+func (srv *Server) StartRecording(app, name string) error {
+	srv.mu.Lock()
+	ls, ok := srv.streams[streamKey{app: app, name: name}]
+	var ns *netStream
+	if ok {
+		ns = ls.publisher
+	}
+	srv.mu.Unlock()
+	if ns == nil {
+		return errStreamNotPublished
+	}
+	policy := srv.dvrPolicy(app)
+	if policy.Path == "" {
+		return errRecordingDisabled
+	}
+	ls.mu.Lock()
+	recording := ls.dvr != nil
+	ls.mu.Unlock()
+	if recording {
+		return errAlreadyRecording
+	}
+
+	dvr, err := newDVRRecorder(ls, app, policy)
+	if err != nil {
+		return err
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	switch {
+	case ls.publisher != ns:
+		err = errStreamNotPublished
+	case ls.dvr != nil:
+		err = errAlreadyRecording
+	case len(ls.gop) > 0:
+		err = dvr.file.writeHeaders(ls.headers(), ls.gop[0].timestamp)
+		for _, m := range ls.gop {
+			if err != nil {
+				break
+			}
+			err = dvr.file.write(m)
+		}
+	default:
+		dvr.waitKeyframe = true
+	}
+	if err != nil {
+		dvr.file.discard()
+		return err
+	}
+	ls.dvr = dvr
+	ls.subscribers[dvr] = struct{}{}
+	srv.logf("Recording %s to %s", ls.name, dvr.file.path)
+	return nil
+}
+
+// StopRecording stops recording the live stream of the application, and finalizes the file.
+func (srv *Server) StopRecording(app, name string) error {
+	srv.mu.Lock()
+	ls, ok := srv.streams[streamKey{app: app, name: name}]
+	if !ok {
+		srv.mu.Unlock()
+		return errNotRecording
+	}
+	ls.mu.Lock()
+	dvr := ls.stopDVR()
+	ls.mu.Unlock()
+	srv.mu.Unlock()
+	if dvr == nil {
+		return errNotRecording
+	}
+	srv.closeDVR(name, dvr)
+	return nil
+}
@@ -0,0 +1,351 @@
+package rtmp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDVRPath(t *testing.T) {
+	srv := &Server{
+		DVRPath:     "/var/dvr/{app}/{name}-{start}.flv",
+		DVRPolicies: map[string]DVRPolicy{"tv": {Path: "/var/tv/{name}-{index}.flv"}},
+	}
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	policy := srv.dvrPolicy("live")
+	if path := policy.path("live", "../cam", start, 0); path != "/var/dvr/live/cam-20200102-030405.flv" {
+		t.Errorf("should be /var/dvr/live/cam-20200102-030405.flv, but got %s", path)
+	}
+	policy = srv.dvrPolicy("tv")
+	if path := policy.path("tv", "cam", start, 2); path != "/var/tv/cam-2.flv" {
+		t.Errorf("should be /var/tv/cam-2.flv, but got %s", path)
+	}
+}
+
+func TestDVR(t *testing.T) {
+	c, client := newConnectedTestConn()
+	defer client.Close()
+	dir := t.TempDir()
+	srv := c.server
+	srv.DVRPath = filepath.Join(dir, "{app}", "{name}.flv")
+	c.app = "live"
+	ns := &netStream{id: 1, conn: c}
+
+	ls, err := srv.publishStream("cam", ns)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	metadata := new(bytes.Buffer)
+	writeAMF0Value(metadata, "onMetaData")
+	writeAMF0Value(metadata, map[string]interface{}{"width": 1280.0})
+	for _, m := range []*message{
+		{typeID: MessageDataAMF0, timestamp: 1000, payload: metadata.Bytes()},
+		{typeID: MessageVideo, timestamp: 1000, payload: []byte{0x17, 0x01, 0x00, 0x00, 0x00}},
+		{typeID: MessageVideo, timestamp: 1040, payload: []byte{0x27, 0x01, 0x00, 0x00, 0x00}},
+	} {
+		ls.handleMessage(ns, m)
+	}
+	srv.unpublishStream("cam", ns)
+	if ls.dvr != nil {
+		t.Errorf("recorder should be removed")
+	}
+	srv.waitFinalized(filepath.Join(dir, "live", "cam.flv"))
+
+	f, err := os.Open(filepath.Join(dir, "live", "cam.flv"))
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	tags, _, err := readFLVTags(f, info.Size())
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if len(tags) != 3 || tags[0].tagType != flvTagScript || !tags[1].keyframe || tags[2].timestamp != 40 {
+		t.Errorf("should be onMetaData and 2 video tags from 0 ms, but got %d tags", len(tags))
+	}
+	data, _ := tags[0].readData(f)
+	if md, err := ReadMetadata(data); err != nil || md.Duration != 0.04 || md.FileSize != float64(info.Size()) {
+		t.Errorf("onMetaData should have the duration and the file size")
+	}
+	flags := make([]byte, 1)
+	if _, err = f.ReadAt(flags, 4); err != nil || flags[0] != 0x01 {
+		t.Errorf("should have only the video flag, but got %#x", flags[0])
+	}
+}
+
+func TestDVRRotation(t *testing.T) {
+	c, client := newConnectedTestConn()
+	defer client.Close()
+	dir := t.TempDir()
+	srv := c.server
+	srv.DVRPolicies = map[string]DVRPolicy{
+		"live": {Path: filepath.Join(dir, "{name}-{index}.flv"), MaxDuration: time.Second},
+	}
+	recordings := make(chan *Recording, 2)
+	srv.OnRecording = func(r *Recording) {
+		recordings <- r
+	}
+	c.app = "live"
+	ns := &netStream{id: 1, conn: c}
+
+	ls, err := srv.publishStream("cam", ns)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	metadata := new(bytes.Buffer)
+	writeAMF0Value(metadata, "@setDataFrame")
+	writeAMF0Value(metadata, "onMetaData")
+	writeAMF0Value(metadata, map[string]interface{}{"width": 1280.0})
+	ls.handleMessage(ns, &message{typeID: MessageDataAMF0, payload: metadata.Bytes()})
+	for _, m := range []*message{
+		{typeID: MessageVideo, timestamp: 0, payload: append([]byte{0x17, 0x00, 0x00, 0x00, 0x00}, testAVCSequenceHeader...)},
+		{typeID: MessageVideo, timestamp: 0, payload: []byte{0x17, 0x01, 0x00, 0x00, 0x00}},
+		// Inter frames do not rotate the recording after the duration.
+		{typeID: MessageVideo, timestamp: 1000, payload: []byte{0x27, 0x01, 0x00, 0x00, 0x00}},
+		{typeID: MessageVideo, timestamp: 1200, payload: []byte{0x17, 0x01, 0x00, 0x00, 0x00}},
+		{typeID: MessageVideo, timestamp: 1240, payload: []byte{0x27, 0x01, 0x00, 0x00, 0x00}},
+	} {
+		ls.handleMessage(ns, m)
+	}
+	srv.unpublishStream("cam", ns)
+
+	paths := make(map[string]*Recording)
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-recordings:
+			paths[r.Path] = r
+		case <-time.After(time.Second):
+			t.Fatalf("should be 2 recordings, but got %d", i)
+		}
+	}
+	first, second := paths[filepath.Join(dir, "cam-0.flv")], paths[filepath.Join(dir, "cam-1.flv")]
+	if first == nil || second == nil {
+		t.Fatalf("should be cam-0.flv and cam-1.flv, but got %v", paths)
+	}
+	if first.Duration != time.Second || second.Duration != 40*time.Millisecond {
+		t.Errorf("should be 1s and 40ms, but got %s and %s", first.Duration, second.Duration)
+	}
+
+	f, err := os.Open(second.Path)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	defer f.Close()
+	tags, _, err := readFLVTags(f, second.Size)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	// onMetaData and the sequence header are re-emitted before the keyframe.
+	if len(tags) != 4 || tags[0].tagType != flvTagScript || tags[1].tagType != flvTagVideo || tags[1].timestamp != 0 || !tags[2].keyframe {
+		t.Fatalf("should be onMetaData, the sequence header and 2 video tags, but got %d tags", len(tags))
+	}
+	data, _ := tags[1].readData(f)
+	if p, err := ReadVideoPacket(0, data); err != nil || !p.IsSequenceHeader() {
+		t.Errorf("should be the sequence header")
+	}
+}
+
+func TestDVRPathCollision(t *testing.T) {
+	c, client := newConnectedTestConn()
+	defer client.Close()
+	dir := t.TempDir()
+	srv := c.server
+	// The path has neither {index} nor {start}, so that every file has the same path.
+	srv.DVRPolicies = map[string]DVRPolicy{
+		"live": {Path: filepath.Join(dir, "{name}.flv"), MaxDuration: time.Second},
+	}
+	recordings := make(chan *Recording, 3)
+	srv.OnRecording = func(r *Recording) {
+		recordings <- r
+	}
+	c.app = "live"
+	ns := &netStream{id: 1, conn: c}
+
+	for i := 0; i < 2; i++ {
+		ls, err := srv.publishStream("cam", ns)
+		if err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+		messages := []*message{
+			{typeID: MessageVideo, timestamp: 0, payload: []byte{0x17, 0x01, 0x00, 0x00, 0x00}},
+			{typeID: MessageVideo, timestamp: 1000, payload: []byte{0x17, 0x01, 0x00, 0x00, 0x00}},
+		}
+		if i == 1 {
+			// The stream published again is recorded to a single file.
+			messages = messages[:1]
+		}
+		for _, m := range messages {
+			ls.handleMessage(ns, m)
+		}
+		srv.unpublishStream("cam", ns)
+	}
+
+	sizes := make(map[string]int64)
+	for i := 0; i < 3; i++ {
+		select {
+		case r := <-recordings:
+			sizes[r.Path] = r.Size
+		case <-time.After(time.Second):
+			t.Fatalf("should be 3 recordings, but got %d", i)
+		}
+	}
+	for _, name := range []string{"cam.flv", "cam-1.flv", "cam-2.flv"} {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+		if size, ok := sizes[path]; !ok || size != info.Size() {
+			t.Errorf("%s should be recorded and kept, but got %d bytes (recorded: %d)", name, info.Size(), size)
+		}
+	}
+}
+
+func TestStartRecording(t *testing.T) {
+	for _, gopCache := range []bool{false, true} {
+		c, client := newConnectedTestConn()
+		dir := t.TempDir()
+		srv := c.server
+		srv.GOPCache = gopCache
+		srv.DVRPolicies = map[string]DVRPolicy{
+			"live": {Path: filepath.Join(dir, "{name}.flv"), Manual: true},
+		}
+		c.app = "live"
+		ns := &netStream{id: 1, conn: c}
+
+		if err := srv.StartRecording("live", "cam"); err != errStreamNotPublished {
+			t.Errorf("should be errStreamNotPublished, but got %v", err)
+		}
+		ls, err := srv.publishStream("cam", ns)
+		if err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+		if ls.dvr != nil {
+			t.Errorf("manual policy should not record when published")
+		}
+		messages := []*message{
+			{typeID: MessageVideo, timestamp: 0, payload: append([]byte{0x17, 0x00, 0x00, 0x00, 0x00}, testAVCSequenceHeader...)},
+			{typeID: MessageVideo, timestamp: 0, payload: []byte{0x17, 0x01, 0x00, 0x00, 0x00}},
+			{typeID: MessageVideo, timestamp: 40, payload: []byte{0x27, 0x01, 0x00, 0x00, 0x00}},
+			{typeID: MessageVideo, timestamp: 80, payload: []byte{0x27, 0x01, 0x00, 0x00, 0x00}},
+			{typeID: MessageVideo, timestamp: 1000, payload: []byte{0x17, 0x01, 0x00, 0x00, 0x00}},
+		}
+		for i, m := range messages {
+			if i == 2 {
+				if err = srv.StartRecording("live", "cam"); err != nil {
+					t.Fatalf("should be nil, but got %s", err)
+				}
+				if err = srv.StartRecording("live", "cam"); err != errAlreadyRecording {
+					t.Errorf("should be errAlreadyRecording, but got %v", err)
+				}
+			}
+			ls.handleMessage(ns, m)
+		}
+		if err = srv.StopRecording("live", "cam"); err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+		if err = srv.StopRecording("live", "cam"); err != errNotRecording {
+			t.Errorf("should be errNotRecording, but got %v", err)
+		}
+		srv.waitFinalized(filepath.Join(dir, "cam.flv"))
+		client.Close()
+
+		f, err := os.Open(filepath.Join(dir, "cam.flv"))
+		if err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+		info, _ := f.Stat()
+		tags, _, err := readFLVTags(f, info.Size())
+		f.Close()
+		if err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+		// The GOP cache begins the file with the keyframe at 0 ms. Otherwise, it begins with
+		// the next keyframe at 1000 ms.
+		want := 2
+		if gopCache {
+			want = 5
+		}
+		if len(tags) != want+1 || tags[0].tagType != flvTagScript || tags[1].tagType != flvTagVideo || !tags[2].keyframe || tags[2].timestamp != 0 {
+			t.Errorf("should be onMetaData, the sequence header and the keyframe, but got %d tags with gopCache=%v", len(tags), gopCache)
+		}
+	}
+}
+
+func TestStopRecordingBeforeKeyframe(t *testing.T) {
+	c, client := newConnectedTestConn()
+	defer client.Close()
+	dir := t.TempDir()
+	srv := c.server
+	srv.DVRPolicies = map[string]DVRPolicy{
+		"live": {Path: filepath.Join(dir, "{name}.flv"), Manual: true},
+	}
+	srv.OnRecording = func(r *Recording) {
+		t.Errorf("should not report the empty recording, but got %s", r.Path)
+	}
+	c.app = "live"
+	ns := &netStream{id: 1, conn: c}
+
+	ls, err := srv.publishStream("cam", ns)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if err = srv.StartRecording("live", "cam"); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	// The inter frame cannot begin the file.
+	m := &message{typeID: MessageVideo, timestamp: 0, payload: []byte{0x27, 0x01, 0x00, 0x00, 0x00}}
+	ls.handleMessage(ns, m)
+	if err = srv.StopRecording("live", "cam"); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	srv.waitFinalized(filepath.Join(dir, "cam.flv"))
+	if _, err = os.Stat(filepath.Join(dir, "cam.flv")); !os.IsNotExist(err) {
+		t.Errorf("the empty recording should be removed, but got %v", err)
+	}
+}
+
+func TestDVRFileDiscard(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cam.flv")
+	f, err := createDVRFile(path, time.Now(), false)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if err = f.discard(); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the new file should be removed, but got %v", err)
+	}
+
+	// The file which is appended to keeps the tags recorded before.
+	if f, err = createDVRFile(path, time.Now(), false); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	f.write(&message{typeID: MessageVideo, payload: []byte{0x17, 0x01, 0x00, 0x00, 0x00}})
+	if err = f.close(); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if f, err = openDVRFile(path, time.Now()); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if err = f.discard(); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	defer file.Close()
+	info, _ := file.Stat()
+	if tags, _, err := readFLVTags(file, info.Size()); err != nil || len(tags) != 2 || !tags[1].keyframe {
+		t.Errorf("should be onMetaData and the keyframe, but got %d tags (%v)", len(tags), err)
+	}
+}
@@ -0,0 +1,341 @@
+package rtmp
+
+import (
+	"errors"
+
+	"github.com/zhangpeihao/goamf"
+)
+
+// A FourCC is a four-character code which identifies a codec in Enhanced RTMP.
+type FourCC uint32
+
+func newFourCC(s string) FourCC {
+	if len(s) != 4 {
+		return 0
+	}
+	return FourCC(uint32(s[0])<<24 | uint32(s[1])<<16 | uint32(s[2])<<8 | uint32(s[3]))
+}
+
+func (f FourCC) String() string {
+	return string([]byte{byte(f >> 24), byte(f >> 16), byte(f >> 8), byte(f)})
+}
+
+const (
+	FourCCAV1  FourCC = 'a'<<24 | 'v'<<16 | '0'<<8 | '1'
+	FourCCVP9         = 'v'<<24 | 'p'<<16 | '0'<<8 | '9'
+	FourCCHEVC        = 'h'<<24 | 'v'<<16 | 'c'<<8 | '1'
+
+	FourCCAC3  = 'a'<<24 | 'c'<<16 | '-'<<8 | '3'
+	FourCCEAC3 = 'e'<<24 | 'c'<<16 | '-'<<8 | '3'
+	FourCCOpus = 'O'<<24 | 'p'<<16 | 'u'<<8 | 's'
+	FourCCFLAC = 'f'<<24 | 'L'<<16 | 'a'<<8 | 'C'
+	FourCCAAC  = 'm'<<24 | 'p'<<16 | '4'<<8 | 'a'
+	FourCCMP3  = '.'<<24 | 'm'<<16 | 'p'<<8 | '3'
+)
+
+// Flags of the FourCC info maps in the connect command, which tell the capabilities for each codec.
+const (
+	FourCCCanDecode  = 0x01
+	FourCCCanEncode  = 0x02
+	FourCCCanForward = 0x04
+)
+
+// Flags of capsEx in the connect command, which tell the extended capabilities.
+const (
+	CapsExReconnect           = 0x01
+	CapsExMultitrack          = 0x02
+	CapsExModEx               = 0x04
+	CapsExTimestampNanoOffset = 0x08
+)
+
+// supportedVideoFourCCs and supportedAudioFourCCs are the codecs which the server can forward.
+var (
+	supportedVideoFourCCs = []FourCC{FourCCAV1, FourCCVP9, FourCCHEVC}
+	supportedAudioFourCCs = []FourCC{FourCCAC3, FourCCEAC3, FourCCOpus, FourCCFLAC, FourCCAAC, FourCCMP3}
+)
+
+// supportedCapsEx is the extended capabilities of the server. Packets with ModEx are accepted,
+// though the modifiers are ignored.
+const supportedCapsEx = CapsExMultitrack | CapsExModEx
+
+// negotiateEnhanced reads the Enhanced RTMP properties of the connect command object.
+// The connection uses Enhanced RTMP if the client sends any of them.
+func (c *Conn) negotiateEnhanced(obj amf.Object) {
+	videoList := readFourCCList(obj)
+	audioList := readAudioFourCCList(obj)
+	capsEx, ok := obj["capsEx"].(float64)
+	if videoList == nil && audioList == nil && !ok {
+		return
+	}
+	c.enhanced = true
+	c.videoFourCCs = negotiateFourCCs(videoList, supportedVideoFourCCs)
+	c.audioFourCCs = negotiateFourCCs(audioList, supportedAudioFourCCs)
+	c.capsEx = uint32(capsEx)
+}
+
+// readFourCCList reads the video codecs of fourCcList or of the keys of the FourCC info map in the
+// connect command object. "*" means any codec.
+func readFourCCList(obj amf.Object) (list []string) {
+	switch v := obj["fourCcList"].(type) {
+	case []interface{}:
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				list = append(list, s)
+			}
+		}
+	case amf.Object:
+		// Some clients send an ECMA array.
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				list = append(list, s)
+			}
+		}
+	}
+	if m, ok := obj["videoFourCcInfoMap"].(amf.Object); ok {
+		for s := range m {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// readAudioFourCCList reads the audio codecs of the keys of audioFourCcInfoMap in the connect command object.
+func readAudioFourCCList(obj amf.Object) (list []string) {
+	if m, ok := obj["audioFourCcInfoMap"].(amf.Object); ok {
+		for s := range m {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// negotiateFourCCs returns the codecs in the list which are supported.
+func negotiateFourCCs(list []string, supported []FourCC) []FourCC {
+	requested := make(map[FourCC]bool)
+	for _, s := range list {
+		if s == "*" {
+			return supported
+		}
+		requested[newFourCC(s)] = true
+	}
+
+	var fourCCs []FourCC
+	for _, f := range supported {
+		if requested[f] {
+			fourCCs = append(fourCCs, f)
+		}
+	}
+	return fourCCs
+}
+
+// VideoFourCCs returns the Enhanced RTMP video codecs negotiated in the connect command.
+func (c *Conn) VideoFourCCs() []FourCC {
+	return c.videoFourCCs
+}
+
+// AudioFourCCs returns the Enhanced RTMP audio codecs negotiated in the connect command.
+func (c *Conn) AudioFourCCs() []FourCC {
+	return c.audioFourCCs
+}
+
+// enhancedConnectResultProperties returns the properties of the connect _result, which tell the
+// client the negotiated codecs. It returns nil if the client does not use Enhanced RTMP.
+func (c *Conn) enhancedConnectResultProperties() map[string]interface{} {
+	if !c.enhanced {
+		return nil
+	}
+	list := make(strictArray, 0, len(c.videoFourCCs))
+	videoInfoMap := make(map[string]interface{})
+	for _, f := range c.videoFourCCs {
+		list = append(list, f.String())
+		videoInfoMap[f.String()] = FourCCCanForward
+	}
+	audioInfoMap := make(map[string]interface{})
+	for _, f := range c.audioFourCCs {
+		audioInfoMap[f.String()] = FourCCCanForward
+	}
+	return map[string]interface{}{
+		"fourCcList":         list,
+		"videoFourCcInfoMap": videoInfoMap,
+		"audioFourCcInfoMap": audioInfoMap,
+		"capsEx":             supportedCapsEx,
+	}
+}
+
+type MultitrackType uint8
+
+const (
+	MultitrackTypeOneTrack             MultitrackType = 0
+	MultitrackTypeManyTracks                          = 1
+	MultitrackTypeManyTracksManyCodecs                = 2
+)
+
+// packetTypeModEx is the packet type of ModEx, which is the same for audio and video.
+const packetTypeModEx = 7
+
+var errInvalidExHeader = errors.New("invalid extended header")
+
+// skipModEx skips the modifier extensions which follow the packet type ModEx, like the
+// nanosecond offset of the timestamp. It returns the actual packet type and the rest of the data.
+//
+//	+----------------------------+-------------+------------------+------------------
+//	| ModExDataSize              | ModExData   | ModExType        | PacketType
+//	| (8 bits, or 16 bits + 255) |             | (4 bits)         | (4 bits)
+//	+----------------------------+-------------+------------------+------------------
+func skipModEx(data []byte) (uint8, []byte, error) {
+	packetType := uint8(packetTypeModEx)
+	for packetType == packetTypeModEx {
+		if len(data) < 1 {
+			return 0, nil, errInvalidExHeader
+		}
+		size := int(data[0]) + 1
+		data = data[1:]
+		if size == 256 {
+			if len(data) < 2 {
+				return 0, nil, errInvalidExHeader
+			}
+			size = (int(data[0])<<8 | int(data[1])) + 1
+			data = data[2:]
+		}
+		if len(data) < size+1 {
+			return 0, nil, errInvalidExHeader
+		}
+		packetType = data[size] & 0x0f
+		data = data[size+1:]
+	}
+	return packetType, data, nil
+}
+
+func readFourCC(data []byte) (FourCC, []byte, error) {
+	if len(data) < 4 {
+		return 0, nil, errInvalidExHeader
+	}
+	return FourCC(uint32(data[0])<<24 | uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3])), data[4:], nil
+}
+
+// A track is a track of a multitrack packet. body is the same as the body of the single-track packet.
+type track struct {
+	id     uint8
+	fourCC FourCC
+	body   []byte
+}
+
+// A multitrack is the data of a multitrack packet, which follows the packet type Multitrack.
+//
+//	+----------------+------------+----------------------+--------------------------------------------
+//	| MultitrackType | PacketType | FourCC               | Tracks
+//	| (4 bits)       | (4 bits)   | (32 bits, one codec) |
+//	+----------------+------------+----------------------+--------------------------------------------
+//
+// Each track has the FourCC if the tracks have different codecs, and the size if there are many tracks.
+//
+//	+-----------------------+---------+------------------------+------
+//	| FourCC                | TrackID | Size                   | Body
+//	| (32 bits, many codecs) | (8 bits) | (24 bits, many tracks) |
+//	+-----------------------+---------+------------------------+------
+type multitrack struct {
+	multitrackType MultitrackType
+	packetType     uint8
+	// fourCC is 0 if the tracks have different codecs.
+	fourCC FourCC
+	tracks []track
+}
+
+func readMultitrack(data []byte) (*multitrack, error) {
+	if len(data) < 1 {
+		return nil, errInvalidExHeader
+	}
+	mt := &multitrack{
+		multitrackType: MultitrackType(data[0] >> 4),
+		packetType:     data[0] & 0x0f,
+	}
+	data = data[1:]
+	var err error
+	if mt.multitrackType != MultitrackTypeManyTracksManyCodecs {
+		if mt.fourCC, data, err = readFourCC(data); err != nil {
+			return nil, err
+		}
+	}
+	for len(data) > 0 {
+		t := track{fourCC: mt.fourCC}
+		if mt.multitrackType == MultitrackTypeManyTracksManyCodecs {
+			if t.fourCC, data, err = readFourCC(data); err != nil {
+				return nil, err
+			}
+		}
+		if len(data) < 1 {
+			return nil, errInvalidExHeader
+		}
+		t.id = data[0]
+		data = data[1:]
+		if mt.multitrackType == MultitrackTypeOneTrack {
+			t.body = data
+			mt.tracks = append(mt.tracks, t)
+			break
+		}
+		if len(data) < 3 {
+			return nil, errInvalidExHeader
+		}
+		size := int(data[0])<<16 | int(data[1])<<8 | int(data[2])
+		data = data[3:]
+		if len(data) < size {
+			return nil, errInvalidExHeader
+		}
+		t.body = data[:size]
+		data = data[size:]
+		mt.tracks = append(mt.tracks, t)
+	}
+	return mt, nil
+}
+
+// selectTrack converts the multitrack audio or video payload to the single-track payload of the track.
+// It returns false if the payload does not have the track. Other payloads are returned as is.
+// The modifier extensions of the multitrack packet are dropped.
+func selectTrack(typeID MessageType, payload []byte, trackID uint8) ([]byte, bool) {
+	if len(payload) < 1 {
+		return payload, true
+	}
+	var header byte
+	var packetTypeMultitrack uint8
+	switch typeID {
+	case MessageAudio:
+		if SoundFormat(payload[0]>>4) != SoundFormatExHeader {
+			return payload, true
+		}
+		header = byte(SoundFormatExHeader) << 4
+		packetTypeMultitrack = AudioPacketTypeMultitrack
+	case MessageVideo:
+		if payload[0]&0x80 == 0 {
+			return payload, true
+		}
+		// Keep IsExHeader and FrameType.
+		header = payload[0] & 0xf0
+		packetTypeMultitrack = VideoPacketTypeMultitrack
+	default:
+		return payload, true
+	}
+
+	packetType, data := payload[0]&0x0f, payload[1:]
+	if packetType == packetTypeModEx {
+		var err error
+		if packetType, data, err = skipModEx(data); err != nil {
+			return nil, false
+		}
+	}
+	if packetType != packetTypeMultitrack {
+		return payload, true
+	}
+	mt, err := readMultitrack(data)
+	if err != nil {
+		return nil, false
+	}
+	for _, t := range mt.tracks {
+		if t.id != trackID {
+			continue
+		}
+		p := make([]byte, 0, 5+len(t.body))
+		p = append(p, header|mt.packetType, byte(t.fourCC>>24), byte(t.fourCC>>16), byte(t.fourCC>>8), byte(t.fourCC))
+		return append(p, t.body...), true
+	}
+	return nil, false
+}
@@ -0,0 +1,74 @@
+package rtmp
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zhangpeihao/goamf"
+)
+
+func TestNegotiateVideoFourCCs(t *testing.T) {
+	for _, tt := range []struct {
+		obj  amf.Object
+		want []FourCC
+	}{
+		{amf.Object{"fourCcList": []interface{}{"hvc1", "avc1", "av01"}}, []FourCC{FourCCAV1, FourCCHEVC}},
+		{amf.Object{"fourCcList": []interface{}{"*"}}, supportedVideoFourCCs},
+		{amf.Object{"videoFourCcInfoMap": amf.Object{"vp09": float64(FourCCCanDecode)}}, []FourCC{FourCCVP9}},
+		{amf.Object{}, nil},
+	} {
+		got := negotiateFourCCs(readFourCCList(tt.obj), supportedVideoFourCCs)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("should be %v, but got %v", tt.want, got)
+		}
+	}
+}
+
+func TestFourCC(t *testing.T) {
+	if f := newFourCC("hvc1"); f != FourCCHEVC || f.String() != "hvc1" {
+		t.Errorf("should be hvc1, but got %s", f)
+	}
+	if f := newFourCC("hvc"); f != 0 {
+		t.Errorf("should be 0 for an invalid FourCC, but got %d", uint32(f))
+	}
+}
+
+func TestSelectTrack(t *testing.T) {
+	multitrack := []byte{
+		0x95, 0x10, 'O', 'p', 'u', 's',
+		0x00, 0x00, 0x00, 0x01, 0xaa,
+		0x01, 0x00, 0x00, 0x02, 0xbb, 0xcc,
+	}
+	for _, tt := range []struct {
+		typeID  MessageType
+		payload []byte
+		trackID uint8
+		want    []byte
+		ok      bool
+	}{
+		{MessageAudio, multitrack, 0, []byte{0x90, 'O', 'p', 'u', 's', 0xaa}, true},
+		{MessageAudio, multitrack, 1, []byte{0x90, 'O', 'p', 'u', 's', 0xbb, 0xcc}, true},
+		{MessageAudio, multitrack, 2, nil, false},
+		// The frame type is kept.
+		{MessageVideo, []byte{0x96, 0x03, 'a', 'v', '0', '1', 0x01, 0xff}, 1, []byte{0x93, 'a', 'v', '0', '1', 0xff}, true},
+		// Single-track packets are not changed.
+		{MessageAudio, []byte{0xaf, 0x01, 0x21}, 1, []byte{0xaf, 0x01, 0x21}, true},
+		{MessageVideo, []byte{0x91, 'a', 'v', '0', '1', 0xff}, 1, []byte{0x91, 'a', 'v', '0', '1', 0xff}, true},
+	} {
+		got, ok := selectTrack(tt.typeID, tt.payload, tt.trackID)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("should be %#v (%t), but got %#v (%t)", tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestTrackSelection(t *testing.T) {
+	c := &Conn{}
+	if audio, video := c.trackSelection("audioTrack=2"); audio != 2 || video != defaultTrack {
+		t.Errorf("should be audio track 2 and the default video track, but got %d and %d", audio, video)
+	}
+	c.capsEx = CapsExMultitrack
+	if audio, video := c.trackSelection("videoTrack=1"); audio != allTracks || video != 1 {
+		t.Errorf("should be all audio tracks and video track 1, but got %d and %d", audio, video)
+	}
+}
@@ -0,0 +1,329 @@
+package rtmp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+const (
+	flvHeaderSize    = 9
+	flvTagHeaderSize = 11
+
+	flvTagAudio  = 8
+	flvTagVideo  = 9
+	flvTagScript = 18
+)
+
+var errInvalidFLV = errors.New("invalid flv file")
+
+// An flvFile writes RTMP messages to a file as FLV tags.
+//
+//	+------------+-----------------+-------+-----------------+-------+-----+
+//	| FLV Header | PreviousTagSize | Tag 1 | PreviousTagSize | Tag 2 | ... |
+//	|            | (0)             |       | (size of Tag 1) |       |     |
+//	+------------+-----------------+-------+-----------------+-------+-----+
+type flvFile struct {
+	file *os.File
+	size int64
+	// lastTimestamp is the timestamp of the last tag in the file.
+	lastTimestamp uint32
+}
+
+// createFLVFile creates a new FLV file, truncating it if exists.
+func createFLVFile(name string) (*flvFile, error) {
+	return createFLVFileFlag(name, os.O_TRUNC)
+}
+
+// createNewFLVFile creates a new FLV file. It fails with an error satisfying os.IsExist if the file exists.
+func createNewFLVFile(name string) (*flvFile, error) {
+	return createFLVFileFlag(name, os.O_EXCL)
+}
+
+func createFLVFileFlag(name string, flag int) (*flvFile, error) {
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	header := []byte{
+		'F', 'L', 'V', 0x01,
+		0x05, // Audio and video tags are present.
+		0x00, 0x00, 0x00, flvHeaderSize,
+		0x00, 0x00, 0x00, 0x00, // PreviousTagSize0
+	}
+	if _, err = file.Write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &flvFile{file: file, size: int64(len(header))}, nil
+}
+
+// openFLVFile opens the FLV file to append tags to it. It creates a new file if not exists.
+// The incomplete tag at the end of the file is discarded.
+func openFLVFile(name string) (*flvFile, error) {
+	file, err := os.OpenFile(name, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return createFLVFile(name)
+	} else if err != nil {
+		return nil, err
+	}
+
+	f := &flvFile{file: file}
+	if err = f.scan(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err = file.Truncate(f.size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err = file.Seek(f.size, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// An flvTag is the position and the header of a tag in an FLV file.
+type flvTag struct {
+	offset    int64 // The offset of the tag header.
+	tagType   uint8
+	dataSize  uint32
+	timestamp uint32
+	keyframe  bool // Whether the tag is a video keyframe.
+}
+
+// end returns the offset following the PreviousTagSize of the tag.
+func (t *flvTag) end() int64 {
+	return t.offset + flvTagHeaderSize + int64(t.dataSize) + 4
+}
+
+// readData reads the data of the tag.
+func (t *flvTag) readData(r io.ReaderAt) ([]byte, error) {
+	data := make([]byte, t.dataSize)
+	if _, err := r.ReadAt(data, t.offset+flvTagHeaderSize); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readFLVTags reads the headers of the complete tags in the FLV file of the size.
+// It returns the offset of the first tag as well.
+func readFLVTags(r io.ReaderAt, size int64) ([]*flvTag, int64, error) {
+	header := make([]byte, flvHeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil || !bytes.Equal(header[:3], []byte("FLV")) {
+		return nil, 0, errInvalidFLV
+	}
+	offset := int64(binary.BigEndian.Uint32(header[5:9])) + 4
+	first := offset
+
+	var tags []*flvTag
+	// Read the first byte of the data as well, to find keyframes.
+	x := make([]byte, flvTagHeaderSize+1)
+	for offset+int64(len(x)) <= size {
+		if _, err := r.ReadAt(x, offset); err != nil {
+			return nil, 0, err
+		}
+		t := &flvTag{
+			offset:    offset,
+			tagType:   x[0],
+			dataSize:  uint32(x[1])<<16 | uint32(x[2])<<8 | uint32(x[3]),
+			timestamp: uint32(x[7])<<24 | uint32(x[4])<<16 | uint32(x[5])<<8 | uint32(x[6]),
+		}
+		if t.end() > size {
+			break
+		}
+		t.keyframe = t.tagType == flvTagVideo && t.dataSize > 0 && VideoFrameType(x[flvTagHeaderSize]>>4&0x07) == VideoFrameTypeKeyframe
+		tags = append(tags, t)
+		offset = t.end()
+	}
+	return tags, first, nil
+}
+
+// scan reads the tags to find the end of the last complete tag and its timestamp.
+func (f *flvFile) scan() error {
+	info, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+	tags, first, err := readFLVTags(f.file, info.Size())
+	if err != nil {
+		return err
+	}
+	f.size = first
+	if len(tags) > 0 {
+		last := tags[len(tags)-1]
+		f.size = last.end()
+		f.lastTimestamp = last.timestamp
+	}
+	return nil
+}
+
+// encodeFLVTag returns an FLV tag followed by its PreviousTagSize.
+func encodeFLVTag(tagType uint8, timestamp uint32, data []byte) []byte {
+	x := make([]byte, flvTagHeaderSize, flvTagHeaderSize+len(data)+4)
+	x[0] = tagType
+	x[1], x[2], x[3] = byte(len(data)>>16), byte(len(data)>>8), byte(len(data))
+	x[4], x[5], x[6], x[7] = byte(timestamp>>16), byte(timestamp>>8), byte(timestamp), byte(timestamp>>24)
+	// StreamID is always 0.
+	x = append(x, data...)
+	x = append(x, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(x[len(x)-4:], uint32(flvTagHeaderSize+len(data)))
+	return x
+}
+
+// writeTag writes an FLV tag followed by its PreviousTagSize.
+func (f *flvFile) writeTag(tagType uint8, timestamp uint32, data []byte) error {
+	n, err := f.file.Write(encodeFLVTag(tagType, timestamp, data))
+	f.size += int64(n)
+	if err != nil {
+		return err
+	}
+	f.lastTimestamp = timestamp
+	return nil
+}
+
+// writeFlags updates the flags of the FLV header, which tell whether audio and video tags are present.
+func (f *flvFile) writeFlags(audio, video bool) error {
+	var flags byte
+	if audio {
+		flags |= 0x04
+	}
+	if video {
+		flags |= 0x01
+	}
+	_, err := f.file.WriteAt([]byte{flags}, 4)
+	return err
+}
+
+// readFlags reads the flags of the FLV header.
+func (f *flvFile) readFlags() (audio, video bool, err error) {
+	x := make([]byte, 1)
+	if _, err = f.file.ReadAt(x, 4); err != nil {
+		return false, false, err
+	}
+	return x[0]&0x04 != 0, x[0]&0x01 != 0, nil
+}
+
+func (f *flvFile) close() error {
+	return f.file.Close()
+}
+
+// finalizeFLV makes the FLV file seekable. The onMetaData, which is the first script tag, is moved to
+// the beginning of the file with the duration, the file size and the keyframes object, in which players
+// look up the positions of keyframes to seek. The file is rewritten to a temporary file which replaces it,
+// so that the original file is intact on failures.
+func finalizeFLV(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	tags, first, err := readFLVTags(src, info.Size())
+	if err != nil {
+		return err
+	}
+
+	properties := make(map[string]interface{})
+	var rest []*flvTag
+	found := false
+	for _, t := range tags {
+		if !found && t.tagType == flvTagScript {
+			data, err := t.readData(src)
+			if err != nil {
+				return err
+			}
+			if md, err := ReadMetadata(data); err == nil {
+				for k, v := range md.Raw {
+					properties[k] = v
+				}
+				found = true
+				continue
+			}
+		}
+		rest = append(rest, t)
+	}
+
+	// AMF0 numbers have a fixed size, so the size of the onMetaData does not depend on the positions.
+	data, err := encodeSeekableMetadata(properties, rest, 0)
+	if err != nil {
+		return err
+	}
+	data, err = encodeSeekableMetadata(properties, rest, first+flvTagHeaderSize+int64(len(data))+4)
+	if err != nil {
+		return err
+	}
+
+	tmp := name + ".tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err = copyFLV(dst, src, first, data, rest); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// copyFLV writes the header of src up to the first tag, the onMetaData and the tags of src.
+func copyFLV(dst io.Writer, src io.ReaderAt, first int64, metadata []byte, tags []*flvTag) error {
+	w := bufio.NewWriter(dst)
+	if _, err := io.Copy(w, io.NewSectionReader(src, 0, first)); err != nil {
+		return err
+	}
+	if _, err := w.Write(encodeFLVTag(flvTagScript, 0, metadata)); err != nil {
+		return err
+	}
+	for _, t := range tags {
+		if _, err := io.Copy(w, io.NewSectionReader(src, t.offset, t.end()-t.offset)); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// encodeSeekableMetadata returns the onMetaData with the properties, the duration, the file size and
+// the keyframes of the tags, which are written from the offset.
+func encodeSeekableMetadata(properties map[string]interface{}, tags []*flvTag, offset int64) ([]byte, error) {
+	times, positions := strictArray{}, strictArray{}
+	var duration uint32
+	for _, t := range tags {
+		if t.keyframe {
+			times = append(times, float64(t.timestamp)/1000)
+			positions = append(positions, float64(offset))
+		}
+		if t.timestamp > duration {
+			duration = t.timestamp
+		}
+		offset += t.end() - t.offset
+	}
+	properties["duration"] = float64(duration) / 1000
+	properties["filesize"] = float64(offset)
+	properties["hasKeyframes"] = len(times) > 0
+	properties["keyframes"] = map[string]interface{}{
+		"times":         times,
+		"filepositions": positions,
+	}
+
+	buf := new(bytes.Buffer)
+	if err := writeAMF0Value(buf, "onMetaData"); err != nil {
+		return nil, err
+	}
+	if err := writeAMF0Value(buf, properties); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,97 @@
+package rtmp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zhangpeihao/goamf"
+)
+
+func TestAppendFLVFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.flv")
+	f, err := createFLVFile(name)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	f.writeTag(flvTagAudio, 0, []byte{0xaf, 0x00, 0x12, 0x10})
+	f.writeTag(flvTagVideo, 0x01000040, []byte{0x17, 0x01, 0x00, 0x00, 0x00})
+	size := f.size
+	f.close()
+
+	// An incomplete tag at the end of the file should be discarded.
+	file, _ := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	file.Write([]byte{flvTagVideo, 0x00, 0x00, 0x10})
+	file.Close()
+
+	f, err = openFLVFile(name)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	defer f.close()
+	if f.size != size {
+		t.Errorf("size should be %d, but got %d", size, f.size)
+	}
+	if f.lastTimestamp != 0x01000040 {
+		t.Errorf("lastTimestamp should be 0x01000040, but got %#x", f.lastTimestamp)
+	}
+	if info, _ := os.Stat(name); info.Size() != size {
+		t.Errorf("file size should be %d, but got %d", size, info.Size())
+	}
+}
+
+func TestFinalizeFLV(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.flv")
+	f, err := createFLVFile(name)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	buf := new(bytes.Buffer)
+	writeAMF0Value(buf, "onMetaData")
+	writeAMF0Value(buf, map[string]interface{}{"width": 1280.0, "duration": 0.0})
+	f.writeTag(flvTagVideo, 0, []byte{0x17, 0x00, 0x00, 0x00, 0x00})
+	f.writeTag(flvTagScript, 0, buf.Bytes())
+	f.writeTag(flvTagVideo, 0, []byte{0x17, 0x01, 0x00, 0x00, 0x00})
+	f.writeTag(flvTagAudio, 20, []byte{0xaf, 0x01, 0x00})
+	f.writeTag(flvTagVideo, 1000, []byte{0x27, 0x01, 0x00, 0x00, 0x00})
+	f.writeTag(flvTagVideo, 2000, []byte{0x17, 0x01, 0x00, 0x00, 0x00})
+	f.close()
+
+	if err = finalizeFLV(name); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	defer file.Close()
+	info, _ := file.Stat()
+	tags, _, err := readFLVTags(file, info.Size())
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if len(tags) != 6 || tags[0].tagType != flvTagScript || tags[1].tagType != flvTagVideo {
+		t.Fatalf("onMetaData should be moved to the first tag")
+	}
+	data, _ := tags[0].readData(file)
+	md, err := ReadMetadata(data)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if md.Width != 1280 || md.Duration != 2 || md.FileSize != float64(info.Size()) {
+		t.Errorf("should be 1280, 2 and %d, but got %v, %v and %v", info.Size(), md.Width, md.Duration, md.FileSize)
+	}
+
+	keyframes, _ := md.Raw["keyframes"].(amf.Object)
+	times, _ := keyframes["times"].([]interface{})
+	positions, _ := keyframes["filepositions"].([]interface{})
+	if len(times) != 3 || len(positions) != 3 {
+		t.Fatalf("should have 3 keyframes, but got %d times and %d positions", len(times), len(positions))
+	}
+	for i, tag := range []*flvTag{tags[1], tags[2], tags[5]} {
+		if positions[i] != float64(tag.offset) || times[i] != float64(tag.timestamp)/1000 {
+			t.Errorf("keyframe %d should be at %d and %d ms, but got %v and %v", i, tag.offset, tag.timestamp, positions[i], times[i])
+		}
+	}
+}
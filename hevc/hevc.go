@@ -0,0 +1,247 @@
+// Package hevc parses the headers of H.265/HEVC video, which are carried by the sequence headers
+// of Enhanced RTMP video messages.
+package hevc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var errInvalidDecoderConfigurationRecord = errors.New("hevc: invalid HEVCDecoderConfigurationRecord")
+
+// NAL unit types of the parameter sets.
+const (
+	NALUnitTypeVPS = 32
+	NALUnitTypeSPS = 33
+	NALUnitTypePPS = 34
+)
+
+// A ProfileTierLevel is the general profile, tier and level, which are in the VPS, the SPS and
+// the HEVCDecoderConfigurationRecord.
+type ProfileTierLevel struct {
+	ProfileSpace              uint8
+	TierFlag                  bool
+	ProfileIDC                uint8
+	ProfileCompatibilityFlags uint32
+	// ConstraintIndicatorFlags has the 48 bits of the flags.
+	ConstraintIndicatorFlags uint64
+	LevelIDC                 uint8
+}
+
+// ProfileName returns the name of the profile, like "Main 10".
+func (ptl *ProfileTierLevel) ProfileName() string {
+	switch ptl.ProfileIDC {
+	case 1:
+		return "Main"
+	case 2:
+		return "Main 10"
+	case 3:
+		return "Main Still Picture"
+	case 4:
+		return "Format Range Extensions"
+	case 5:
+		return "High Throughput"
+	case 9:
+		return "Screen Content Coding"
+	}
+	return fmt.Sprintf("Profile(%d)", ptl.ProfileIDC)
+}
+
+// Level returns the level, like 3.1.
+func (ptl *ProfileTierLevel) Level() float64 {
+	return float64(ptl.LevelIDC) / 30
+}
+
+// CodecString returns the codecs parameter defined in ISO/IEC 14496-15 Annex E, like "hvc1.1.6.L93.B0",
+// which is used by MP4 and HLS.
+func (ptl *ProfileTierLevel) CodecString() string {
+	var b strings.Builder
+	b.WriteString("hvc1.")
+	if ptl.ProfileSpace > 0 {
+		b.WriteByte('A' + ptl.ProfileSpace - 1)
+	}
+	fmt.Fprintf(&b, "%d", ptl.ProfileIDC)
+
+	// The compatibility flags are in the reverse bit order.
+	var compatibility uint32
+	for i := uint(0); i < 32; i++ {
+		compatibility |= (ptl.ProfileCompatibilityFlags >> i & 1) << (31 - i)
+	}
+	fmt.Fprintf(&b, ".%X", compatibility)
+
+	tier := 'L'
+	if ptl.TierFlag {
+		tier = 'H'
+	}
+	fmt.Fprintf(&b, ".%c%d", tier, ptl.LevelIDC)
+
+	// The constraint bytes, of which the trailing zero bytes are omitted.
+	var constraints [6]byte
+	n := 0
+	for i := range constraints {
+		constraints[i] = byte(ptl.ConstraintIndicatorFlags >> uint(40-8*i))
+		if constraints[i] != 0 {
+			n = i + 1
+		}
+	}
+	for _, c := range constraints[:n] {
+		fmt.Fprintf(&b, ".%X", c)
+	}
+	return b.String()
+}
+
+// A NALUnitArray is the NAL units of a type in the HEVCDecoderConfigurationRecord.
+type NALUnitArray struct {
+	// Completeness reports whether all NAL units of the type are in the array.
+	Completeness bool
+	NALUnitType  uint8
+	NALUnits     [][]byte
+}
+
+// A DecoderConfigurationRecord is the HEVCDecoderConfigurationRecord defined in ISO/IEC 14496-15,
+// which is the data of HEVC sequence headers and of hvcC boxes.
+//
+//	+----------------------+---------------+-----------+-------------+-----------------+------------------
+//	| configurationVersion | profile_space | tier_flag | profile_idc | compatibility   | constraint
+//	| (8 bits)             | (2 bits)      | (1 bit)   | (5 bits)    | (32 bits)       | (48 bits)
+//	+----------------------+---------------+-----------+-------------+-----------------+------------------
+//	| level_idc | min_spatial_segmentation_idc | parallelismType | chromaFormat | bitDepthLumaMinus8
+//	| (8 bits)  | (4 + 12 bits)                | (6 + 2 bits)    | (6 + 2 bits) | (5 + 3 bits)
+//	+-----------+------------------------------+-----------------+--------------+--------------------
+//	| bitDepthChromaMinus8 | avgFrameRate | constantFrameRate | numTemporalLayers | temporalIdNested
+//	| (5 + 3 bits)         | (16 bits)    | (2 bits)          | (3 bits)          | (1 bit)
+//	+----------------------+--------------+-------------------+-------------------+------------------
+//	| lengthSizeMinusOne | numOfArrays | arrays ...
+//	| (2 bits)           | (8 bits)    |
+//	+--------------------+-------------+-----------
+//
+// Each array has the completeness (1 bit), the reserved bit, the NAL unit type (6 bits) and
+// the 16-bit number of the NAL units, each of which has the 16-bit length.
+type DecoderConfigurationRecord struct {
+	ConfigurationVersion      uint8
+	ProfileTierLevel          ProfileTierLevel
+	MinSpatialSegmentationIDC uint16
+	ParallelismType           uint8
+	ChromaFormat              uint8
+	BitDepthLuma              uint8
+	BitDepthChroma            uint8
+	AvgFrameRate              uint16
+	ConstantFrameRate         uint8
+	NumTemporalLayers         uint8
+	TemporalIDNested          bool
+	// LengthSize is the size in bytes of the length of each NAL unit in video frames.
+	LengthSize int
+	Arrays     []NALUnitArray
+}
+
+// decoderConfigurationRecordHeaderSize is the size of the record before the arrays.
+const decoderConfigurationRecordHeaderSize = 23
+
+// ParseDecoderConfigurationRecord parses the HEVCDecoderConfigurationRecord.
+func ParseDecoderConfigurationRecord(data []byte) (*DecoderConfigurationRecord, error) {
+	if len(data) < decoderConfigurationRecordHeaderSize || data[0] != 1 {
+		return nil, errInvalidDecoderConfigurationRecord
+	}
+	constraints := uint64(binary.BigEndian.Uint16(data[6:]))<<32 | uint64(binary.BigEndian.Uint32(data[8:]))
+	r := &DecoderConfigurationRecord{
+		ConfigurationVersion: data[0],
+		ProfileTierLevel: ProfileTierLevel{
+			ProfileSpace:              data[1] >> 6,
+			TierFlag:                  data[1]&0x20 != 0,
+			ProfileIDC:                data[1] & 0x1f,
+			ProfileCompatibilityFlags: binary.BigEndian.Uint32(data[2:]),
+			ConstraintIndicatorFlags:  constraints,
+			LevelIDC:                  data[12],
+		},
+		MinSpatialSegmentationIDC: binary.BigEndian.Uint16(data[13:]) & 0x0fff,
+		ParallelismType:           data[15] & 0x03,
+		ChromaFormat:              data[16] & 0x03,
+		BitDepthLuma:              data[17]&0x07 + 8,
+		BitDepthChroma:            data[18]&0x07 + 8,
+		AvgFrameRate:              binary.BigEndian.Uint16(data[19:]),
+		ConstantFrameRate:         data[21] >> 6,
+		NumTemporalLayers:         data[21] >> 3 & 0x07,
+		TemporalIDNested:          data[21]&0x04 != 0,
+		LengthSize:                int(data[21]&0x03) + 1,
+	}
+
+	numArrays := int(data[22])
+	data = data[decoderConfigurationRecordHeaderSize:]
+	for i := 0; i < numArrays; i++ {
+		if len(data) < 3 {
+			return nil, errInvalidDecoderConfigurationRecord
+		}
+		a := NALUnitArray{
+			Completeness: data[0]&0x80 != 0,
+			NALUnitType:  data[0] & 0x3f,
+		}
+		numNALUnits := int(binary.BigEndian.Uint16(data[1:]))
+		data = data[3:]
+		for j := 0; j < numNALUnits; j++ {
+			if len(data) < 2 {
+				return nil, errInvalidDecoderConfigurationRecord
+			}
+			size := int(binary.BigEndian.Uint16(data))
+			data = data[2:]
+			if len(data) < size {
+				return nil, errInvalidDecoderConfigurationRecord
+			}
+			a.NALUnits = append(a.NALUnits, data[:size])
+			data = data[size:]
+		}
+		r.Arrays = append(r.Arrays, a)
+	}
+	return r, nil
+}
+
+// NALUnits returns the NAL units of the type, like NALUnitTypeSPS.
+func (r *DecoderConfigurationRecord) NALUnits(nalUnitType uint8) [][]byte {
+	var nalUnits [][]byte
+	for _, a := range r.Arrays {
+		if a.NALUnitType == nalUnitType {
+			nalUnits = append(nalUnits, a.NALUnits...)
+		}
+	}
+	return nalUnits
+}
+
+// Bytes returns the HEVCDecoderConfigurationRecord, which is the payload of the hvcC box.
+func (r *DecoderConfigurationRecord) Bytes() []byte {
+	ptl := r.ProfileTierLevel
+	b := make([]byte, decoderConfigurationRecordHeaderSize)
+	b[0] = r.ConfigurationVersion
+	b[1] = ptl.ProfileSpace<<6 | ptl.ProfileIDC&0x1f
+	if ptl.TierFlag {
+		b[1] |= 0x20
+	}
+	binary.BigEndian.PutUint32(b[2:], ptl.ProfileCompatibilityFlags)
+	binary.BigEndian.PutUint16(b[6:], uint16(ptl.ConstraintIndicatorFlags>>32))
+	binary.BigEndian.PutUint32(b[8:], uint32(ptl.ConstraintIndicatorFlags))
+	b[12] = ptl.LevelIDC
+	binary.BigEndian.PutUint16(b[13:], 0xf000|r.MinSpatialSegmentationIDC)
+	b[15] = 0xfc | r.ParallelismType
+	b[16] = 0xfc | r.ChromaFormat
+	b[17] = 0xf8 | (r.BitDepthLuma-8)&0x07
+	b[18] = 0xf8 | (r.BitDepthChroma-8)&0x07
+	binary.BigEndian.PutUint16(b[19:], r.AvgFrameRate)
+	b[21] = r.ConstantFrameRate<<6 | r.NumTemporalLayers<<3 | byte(r.LengthSize-1)&0x03
+	if r.TemporalIDNested {
+		b[21] |= 0x04
+	}
+	b[22] = byte(len(r.Arrays))
+
+	for _, a := range r.Arrays {
+		header := a.NALUnitType & 0x3f
+		if a.Completeness {
+			header |= 0x80
+		}
+		b = append(b, header, byte(len(a.NALUnits)>>8), byte(len(a.NALUnits)))
+		for _, nalu := range a.NALUnits {
+			b = append(b, byte(len(nalu)>>8), byte(len(nalu)))
+			b = append(b, nalu...)
+		}
+	}
+	return b
+}
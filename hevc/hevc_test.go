@@ -0,0 +1,106 @@
+package hevc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/c-bata/rtmp/internal/bits"
+)
+
+// A bitWriter writes the fields of the parameter sets for tests.
+type bitWriter struct {
+	bits.Writer
+}
+
+// nalu returns the NAL unit of the RBSP, into which the emulation prevention bytes are inserted.
+func (w *bitWriter) nalu(nalUnitType uint8) []byte {
+	w.WriteBits(1, 1) // rbsp_stop_one_bit
+	nalu := []byte{nalUnitType << 1, 0x01}
+	zeros := 0
+	for _, b := range w.Bytes() {
+		if zeros >= 2 && b <= 0x03 {
+			nalu = append(nalu, 0x03)
+			zeros = 0
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		nalu = append(nalu, b)
+	}
+	return nalu
+}
+
+// testPTL is Main profile, Main tier, level 4.0.
+var testPTL = ProfileTierLevel{
+	ProfileIDC:                1,
+	ProfileCompatibilityFlags: 0x60000000,
+	ConstraintIndicatorFlags:  0x900000000000,
+	LevelIDC:                  120,
+}
+
+func (w *bitWriter) profileTierLevel(ptl ProfileTierLevel) {
+	w.WriteBits(uint64(ptl.ProfileSpace), 2)
+	w.WriteBits(0, 1)
+	w.WriteBits(uint64(ptl.ProfileIDC), 5)
+	w.WriteBits(uint64(ptl.ProfileCompatibilityFlags), 32)
+	w.WriteBits(ptl.ConstraintIndicatorFlags, 48)
+	w.WriteBits(uint64(ptl.LevelIDC), 8)
+}
+
+func TestCodecString(t *testing.T) {
+	for _, tt := range []struct {
+		ptl  ProfileTierLevel
+		want string
+	}{
+		{testPTL, "hvc1.1.6.L120.90"},
+		{ProfileTierLevel{ProfileIDC: 2, ProfileCompatibilityFlags: 0x20000000, ConstraintIndicatorFlags: 0xb00000000000, LevelIDC: 93}, "hvc1.2.4.L93.B0"},
+		{ProfileTierLevel{ProfileSpace: 1, TierFlag: true, ProfileIDC: 4, ProfileCompatibilityFlags: 0x08000000, ConstraintIndicatorFlags: 0x9c2000000001, LevelIDC: 153}, "hvc1.A4.10.H153.9C.20.0.0.0.1"},
+	} {
+		if got := tt.ptl.CodecString(); got != tt.want {
+			t.Errorf("should be %s, but got %s", tt.want, got)
+		}
+	}
+	if testPTL.ProfileName() != "Main" || testPTL.Level() != 4 {
+		t.Errorf("should be Main 4.0, but got %s %.1f", testPTL.ProfileName(), testPTL.Level())
+	}
+}
+
+func TestParseDecoderConfigurationRecord(t *testing.T) {
+	record := &DecoderConfigurationRecord{
+		ConfigurationVersion: 1,
+		ProfileTierLevel:     testPTL,
+		ChromaFormat:         1,
+		BitDepthLuma:         10,
+		BitDepthChroma:       10,
+		NumTemporalLayers:    1,
+		TemporalIDNested:     true,
+		LengthSize:           4,
+		Arrays: []NALUnitArray{
+			{Completeness: true, NALUnitType: NALUnitTypeVPS, NALUnits: [][]byte{{0x40, 0x01, 0x0c}}},
+			{Completeness: true, NALUnitType: NALUnitTypeSPS, NALUnits: [][]byte{{0x42, 0x01, 0x01}, {0x42, 0x01, 0x02}}},
+			{Completeness: true, NALUnitType: NALUnitTypePPS, NALUnits: [][]byte{{0x44, 0x01}}},
+		},
+	}
+	data := record.Bytes()
+	if data[0] != 1 || data[1] != 0x01 || data[21] != 0x0f || data[22] != 3 {
+		t.Errorf("should be the record of Main profile with 3 arrays, but got %#v", data[:23])
+	}
+
+	got, err := ParseDecoderConfigurationRecord(data)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if !reflect.DeepEqual(got, record) {
+		t.Errorf("should be %#v, but got %#v", record, got)
+	}
+	if sps := got.NALUnits(NALUnitTypeSPS); len(sps) != 2 || !bytes.Equal(sps[1], []byte{0x42, 0x01, 0x02}) {
+		t.Errorf("should be 2 SPSs, but got %#v", sps)
+	}
+
+	if _, err = ParseDecoderConfigurationRecord(data[:len(data)-1]); err == nil {
+		t.Errorf("should be error for the truncated PPS")
+	}
+}
@@ -0,0 +1,176 @@
+package hevc
+
+import (
+	"errors"
+
+	"github.com/c-bata/rtmp/internal/bits"
+)
+
+var errInvalidSPS = errors.New("hevc: invalid SPS")
+
+// An SPS is the sequence parameter set defined in ITU-T H.265, which has the properties of the video.
+type SPS struct {
+	VideoParameterSetID uint8
+	MaxSubLayers        uint8
+	TemporalIDNesting   bool
+	ProfileTierLevel    ProfileTierLevel
+	SeqParameterSetID   uint
+
+	ChromaFormatIDC uint
+	BitDepthLuma    uint
+	BitDepthChroma  uint
+
+	// Width and Height are the size of the pictures in pixels, excluding the conformance window.
+	Width  int
+	Height int
+}
+
+// nalUnitType returns the type of the NAL unit, which has the 2-byte header.
+func nalUnitType(nalu []byte) uint8 {
+	return nalu[0] >> 1 & 0x3f
+}
+
+// ParseSPS parses the NAL unit of the SPS, which has the emulation prevention bytes.
+func ParseSPS(nalu []byte) (*SPS, error) {
+	if len(nalu) < 3 || nalUnitType(nalu) != NALUnitTypeSPS {
+		return nil, errInvalidSPS
+	}
+	s := &SPS{}
+	if err := s.parse(bits.NewReader(bits.RemoveEmulationPrevention(nalu[2:]))); err != nil {
+		return nil, errInvalidSPS
+	}
+	return s, nil
+}
+
+func (s *SPS) parse(r *bits.Reader) error {
+	v, err := r.ReadBits(4)
+	if err != nil {
+		return err
+	}
+	s.VideoParameterSetID = uint8(v)
+	if v, err = r.ReadBits(3); err != nil {
+		return err
+	}
+	s.MaxSubLayers = uint8(v) + 1
+	if s.TemporalIDNesting, err = r.ReadFlag(); err != nil {
+		return err
+	}
+	if err = s.ProfileTierLevel.parse(r, s.MaxSubLayers-1); err != nil {
+		return err
+	}
+	if s.SeqParameterSetID, err = r.ReadUE(); err != nil {
+		return err
+	}
+
+	if s.ChromaFormatIDC, err = r.ReadUE(); err != nil {
+		return err
+	}
+	if s.ChromaFormatIDC > 3 {
+		return errInvalidSPS
+	}
+	separateColourPlane := false
+	if s.ChromaFormatIDC == 3 {
+		if separateColourPlane, err = r.ReadFlag(); err != nil {
+			return err
+		}
+	}
+	width, err := r.ReadUE()
+	if err != nil {
+		return err
+	}
+	height, err := r.ReadUE()
+	if err != nil {
+		return err
+	}
+	s.Width, s.Height = int(width), int(height)
+
+	conformanceWindow, err := r.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if conformanceWindow {
+		var offsets [4]uint // left, right, top and bottom
+		for i := range offsets {
+			if offsets[i], err = r.ReadUE(); err != nil {
+				return err
+			}
+		}
+		subWidth, subHeight := 1, 1
+		if !separateColourPlane {
+			// SubWidthC and SubHeightC of monochrome, 4:2:0, 4:2:2 and 4:4:4.
+			subWidth = [4]int{1, 2, 2, 1}[s.ChromaFormatIDC]
+			subHeight = [4]int{1, 2, 1, 1}[s.ChromaFormatIDC]
+		}
+		s.Width -= int(offsets[0]+offsets[1]) * subWidth
+		s.Height -= int(offsets[2]+offsets[3]) * subHeight
+	}
+
+	var depth uint
+	if depth, err = r.ReadUE(); err != nil {
+		return err
+	}
+	s.BitDepthLuma = depth + 8
+	if depth, err = r.ReadUE(); err != nil {
+		return err
+	}
+	s.BitDepthChroma = depth + 8
+	return nil
+}
+
+// parse parses profile_tier_level with profilePresentFlag 1.
+func (ptl *ProfileTierLevel) parse(r *bits.Reader, maxSubLayersMinus1 uint8) error {
+	v, err := r.ReadBits(8)
+	if err != nil {
+		return err
+	}
+	ptl.ProfileSpace = uint8(v >> 6)
+	ptl.TierFlag = v&0x20 != 0
+	ptl.ProfileIDC = uint8(v & 0x1f)
+	if v, err = r.ReadBits(32); err != nil {
+		return err
+	}
+	ptl.ProfileCompatibilityFlags = uint32(v)
+	high, err := r.ReadBits(16)
+	if err != nil {
+		return err
+	}
+	low, err := r.ReadBits(32)
+	if err != nil {
+		return err
+	}
+	ptl.ConstraintIndicatorFlags = uint64(high)<<32 | uint64(low)
+	if v, err = r.ReadBits(8); err != nil {
+		return err
+	}
+	ptl.LevelIDC = uint8(v)
+
+	// The profiles and levels of the sub-layers are skipped.
+	var profilePresent, levelPresent [8]bool
+	for i := 0; i < int(maxSubLayersMinus1); i++ {
+		if profilePresent[i], err = r.ReadFlag(); err != nil {
+			return err
+		}
+		if levelPresent[i], err = r.ReadFlag(); err != nil {
+			return err
+		}
+	}
+	if maxSubLayersMinus1 > 0 {
+		// reserved_zero_2bits
+		if err = r.Skip(2 * (8 - int(maxSubLayersMinus1))); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < int(maxSubLayersMinus1); i++ {
+		if profilePresent[i] {
+			if err = r.Skip(88); err != nil {
+				return err
+			}
+		}
+		if levelPresent[i] {
+			if err = r.Skip(8); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package hevc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSPS(t *testing.T) {
+	w := &bitWriter{}
+	w.WriteBits(0, 4) // sps_video_parameter_set_id
+	w.WriteBits(0, 3) // sps_max_sub_layers_minus1
+	w.WriteBits(1, 1) // sps_temporal_id_nesting_flag
+	w.profileTierLevel(testPTL)
+	w.WriteUE(0)    // sps_seq_parameter_set_id
+	w.WriteUE(1)    // chroma_format_idc
+	w.WriteUE(1920) // pic_width_in_luma_samples
+	w.WriteUE(1088) // pic_height_in_luma_samples
+	w.WriteBits(1, 1)
+	w.WriteUE(0)
+	w.WriteUE(0)
+	w.WriteUE(0)
+	w.WriteUE(4)
+	w.WriteUE(2) // bit_depth_luma_minus8
+	w.WriteUE(2) // bit_depth_chroma_minus8
+	nalu := w.nalu(NALUnitTypeSPS)
+
+	s, err := ParseSPS(nalu)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if s.Width != 1920 || s.Height != 1080 || s.ChromaFormatIDC != 1 || s.BitDepthLuma != 10 || s.BitDepthChroma != 10 {
+		t.Errorf("should be 1920x1080 4:2:0 10-bit, but got %dx%d, chroma format %d, %d-bit", s.Width, s.Height, s.ChromaFormatIDC, s.BitDepthLuma)
+	}
+	if !reflect.DeepEqual(s.ProfileTierLevel, testPTL) {
+		t.Errorf("should be %#v, but got %#v", testPTL, s.ProfileTierLevel)
+	}
+
+	if _, err = ParseSPS(nalu[:8]); err == nil {
+		t.Errorf("should be error for the truncated SPS")
+	}
+	if _, err = ParseSPS([]byte{0x40, 0x01, 0x0c}); err == nil {
+		t.Errorf("should be error for the VPS")
+	}
+}
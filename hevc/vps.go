@@ -0,0 +1,116 @@
+package hevc
+
+import (
+	"errors"
+
+	"github.com/c-bata/rtmp/internal/bits"
+)
+
+var errInvalidVPS = errors.New("hevc: invalid VPS")
+
+// A VPS is the video parameter set defined in ITU-T H.265.
+type VPS struct {
+	VideoParameterSetID uint8
+	MaxLayers           uint8
+	MaxSubLayers        uint8
+	TemporalIDNesting   bool
+	ProfileTierLevel    ProfileTierLevel
+
+	// NumUnitsInTick and TimeScale are the timing information, which are 0 if it is absent.
+	NumUnitsInTick uint32
+	TimeScale      uint32
+}
+
+// FrameRate returns the frame rate from the timing information, or 0 if it is absent.
+func (v *VPS) FrameRate() float64 {
+	if v.NumUnitsInTick == 0 {
+		return 0
+	}
+	return float64(v.TimeScale) / float64(v.NumUnitsInTick)
+}
+
+// ParseVPS parses the NAL unit of the VPS, which has the emulation prevention bytes.
+func ParseVPS(nalu []byte) (*VPS, error) {
+	if len(nalu) < 3 || nalUnitType(nalu) != NALUnitTypeVPS {
+		return nil, errInvalidVPS
+	}
+	v := &VPS{}
+	if err := v.parse(bits.NewReader(bits.RemoveEmulationPrevention(nalu[2:]))); err != nil {
+		return nil, errInvalidVPS
+	}
+	return v, nil
+}
+
+func (v *VPS) parse(r *bits.Reader) error {
+	x, err := r.ReadBits(4)
+	if err != nil {
+		return err
+	}
+	v.VideoParameterSetID = uint8(x)
+	// vps_base_layer_internal_flag and vps_base_layer_available_flag
+	if err = r.Skip(2); err != nil {
+		return err
+	}
+	if x, err = r.ReadBits(6); err != nil {
+		return err
+	}
+	v.MaxLayers = uint8(x) + 1
+	if x, err = r.ReadBits(3); err != nil {
+		return err
+	}
+	v.MaxSubLayers = uint8(x) + 1
+	if v.TemporalIDNesting, err = r.ReadFlag(); err != nil {
+		return err
+	}
+	// vps_reserved_0xffff_16bits
+	if err = r.Skip(16); err != nil {
+		return err
+	}
+	if err = v.ProfileTierLevel.parse(r, v.MaxSubLayers-1); err != nil {
+		return err
+	}
+
+	orderingInfo, err := r.ReadFlag()
+	if err != nil {
+		return err
+	}
+	first := v.MaxSubLayers - 1
+	if orderingInfo {
+		first = 0
+	}
+	for i := first; i < v.MaxSubLayers; i++ {
+		// vps_max_dec_pic_buffering_minus1, vps_max_num_reorder_pics and vps_max_latency_increase_plus1
+		for j := 0; j < 3; j++ {
+			if _, err = r.ReadUE(); err != nil {
+				return err
+			}
+		}
+	}
+
+	maxLayerID, err := r.ReadBits(6)
+	if err != nil {
+		return err
+	}
+	numLayerSetsMinus1, err := r.ReadUE()
+	if err != nil {
+		return err
+	}
+	// layer_id_included_flag
+	if err = r.Skip(int(numLayerSetsMinus1) * int(maxLayerID+1)); err != nil {
+		return err
+	}
+
+	timing, err := r.ReadFlag()
+	if err != nil || !timing {
+		return err
+	}
+	if x, err = r.ReadBits(32); err != nil {
+		return err
+	}
+	v.NumUnitsInTick = uint32(x)
+	if x, err = r.ReadBits(32); err != nil {
+		return err
+	}
+	v.TimeScale = uint32(x)
+	return nil
+}
@@ -0,0 +1,34 @@
+package hevc
+
+import "testing"
+
+func TestParseVPS(t *testing.T) {
+	w := &bitWriter{}
+	w.WriteBits(0, 4)       // vps_video_parameter_set_id
+	w.WriteBits(3, 2)       // vps_base_layer_internal_flag and vps_base_layer_available_flag
+	w.WriteBits(0, 6)       // vps_max_layers_minus1
+	w.WriteBits(0, 3)       // vps_max_sub_layers_minus1
+	w.WriteBits(1, 1)       // vps_temporal_id_nesting_flag
+	w.WriteBits(0xffff, 16) // vps_reserved_0xffff_16bits
+	w.profileTierLevel(testPTL)
+	w.WriteBits(1, 1) // vps_sub_layer_ordering_info_present_flag
+	w.WriteUE(4)
+	w.WriteUE(0)
+	w.WriteUE(0)
+	w.WriteBits(0, 6) // vps_max_layer_id
+	w.WriteUE(0)      // vps_num_layer_sets_minus1
+	w.WriteBits(1, 1) // vps_timing_info_present_flag
+	w.WriteBits(1001, 32)
+	w.WriteBits(60000, 32)
+
+	v, err := ParseVPS(w.nalu(NALUnitTypeVPS))
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if v.MaxLayers != 1 || v.MaxSubLayers != 1 || v.ProfileTierLevel.LevelIDC != 120 {
+		t.Errorf("should be 1 layer of level 120, but got %#v", v)
+	}
+	if fps := v.FrameRate(); fps < 59.94 || fps > 59.95 {
+		t.Errorf("should be 59.94 fps, but got %f", fps)
+	}
+}
@@ -0,0 +1,114 @@
+// Package bits reads bit fields of codec headers, like the SPS of H.264 and H.265.
+package bits
+
+import "errors"
+
+var ErrUnexpectedEOF = errors.New("bits: unexpected EOF")
+
+// A Reader reads bits from a byte slice in big-endian order.
+type Reader struct {
+	data []byte
+	pos  int // position in bits
+}
+
+func NewReader(data []byte) *Reader {
+	return &Reader{data: data}
+}
+
+// Len returns the number of the unread bits.
+func (r *Reader) Len() int {
+	return len(r.data)*8 - r.pos
+}
+
+// ReadBit reads a bit.
+func (r *Reader) ReadBit() (uint, error) {
+	if r.pos >= len(r.data)*8 {
+		return 0, ErrUnexpectedEOF
+	}
+	b := r.data[r.pos/8] >> (7 - uint(r.pos%8)) & 1
+	r.pos++
+	return uint(b), nil
+}
+
+// ReadFlag reads a bit as a boolean.
+func (r *Reader) ReadFlag() (bool, error) {
+	b, err := r.ReadBit()
+	return b == 1, err
+}
+
+// ReadBits reads n bits, up to 32 bits.
+func (r *Reader) ReadBits(n int) (uint, error) {
+	if n > r.Len() {
+		return 0, ErrUnexpectedEOF
+	}
+	var v uint
+	for i := 0; i < n; i++ {
+		b, _ := r.ReadBit()
+		v = v<<1 | b
+	}
+	return v, nil
+}
+
+// Skip skips n bits.
+func (r *Reader) Skip(n int) error {
+	if n > r.Len() {
+		return ErrUnexpectedEOF
+	}
+	r.pos += n
+	return nil
+}
+
+// ReadUE reads an unsigned integer of Exp-Golomb code, which is ue(v) in H.264 and H.265.
+func (r *Reader) ReadUE() (uint, error) {
+	zeros := 0
+	for {
+		b, err := r.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+		if b == 1 {
+			break
+		}
+		zeros++
+		if zeros > 31 {
+			return 0, ErrUnexpectedEOF
+		}
+	}
+	v, err := r.ReadBits(zeros)
+	if err != nil {
+		return 0, err
+	}
+	return 1<<uint(zeros) - 1 + v, nil
+}
+
+// ReadSE reads a signed integer of Exp-Golomb code, which is se(v) in H.264 and H.265.
+func (r *Reader) ReadSE() (int, error) {
+	v, err := r.ReadUE()
+	if err != nil {
+		return 0, err
+	}
+	if v%2 == 1 {
+		return int(v+1) / 2, nil
+	}
+	return -int(v / 2), nil
+}
+
+// RemoveEmulationPrevention returns the RBSP of the NAL unit, in which the emulation prevention
+// bytes, 0x03 of 0x000003, are removed.
+func RemoveEmulationPrevention(nalu []byte) []byte {
+	rbsp := make([]byte, 0, len(nalu))
+	zeros := 0
+	for _, b := range nalu {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		rbsp = append(rbsp, b)
+	}
+	return rbsp
+}
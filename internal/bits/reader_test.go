@@ -0,0 +1,61 @@
+package bits
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReadUE(t *testing.T) {
+	// 1, 010, 011, 00100, 00111, 0001000
+	r := NewReader([]byte{0xa6, 0x43, 0x88})
+	for _, want := range []uint{0, 1, 2, 3, 6, 7} {
+		v, err := r.ReadUE()
+		if err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+		if v != want {
+			t.Errorf("should be %d, but got %d", want, v)
+		}
+	}
+	if _, err := r.ReadUE(); err != ErrUnexpectedEOF {
+		t.Errorf("should be ErrUnexpectedEOF, but got %v", err)
+	}
+}
+
+func TestReadSE(t *testing.T) {
+	// 1, 010, 011, 00100, 00101
+	r := NewReader([]byte{0xa6, 0x42, 0x80})
+	for _, want := range []int{0, 1, -1, 2, -2} {
+		v, err := r.ReadSE()
+		if err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+		if v != want {
+			t.Errorf("should be %d, but got %d", want, v)
+		}
+	}
+}
+
+func TestReadBits(t *testing.T) {
+	r := NewReader([]byte{0xb5, 0x0f})
+	if v, _ := r.ReadBits(3); v != 5 {
+		t.Errorf("should be 5, but got %d", v)
+	}
+	if err := r.Skip(5); err != nil {
+		t.Errorf("should be nil, but got %s", err)
+	}
+	if v, _ := r.ReadBits(8); v != 0x0f {
+		t.Errorf("should be 15, but got %d", v)
+	}
+	if _, err := r.ReadBits(1); err != ErrUnexpectedEOF {
+		t.Errorf("should be ErrUnexpectedEOF, but got %v", err)
+	}
+}
+
+func TestRemoveEmulationPrevention(t *testing.T) {
+	got := RemoveEmulationPrevention([]byte{0x67, 0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x03, 0x00, 0x03})
+	want := []byte{0x67, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x03}
+	if !bytes.Equal(got, want) {
+		t.Errorf("should be %#v, but got %#v", want, got)
+	}
+}
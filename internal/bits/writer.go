@@ -0,0 +1,33 @@
+package bits
+
+// A Writer writes bits to a byte slice in big-endian order. It builds codec headers in tests.
+type Writer struct {
+	data []byte
+	pos  int // position in bits
+}
+
+// Bytes returns the written bits. The last byte is padded with zero bits.
+func (w *Writer) Bytes() []byte {
+	return w.data
+}
+
+// WriteBits writes the lower n bits of v.
+func (w *Writer) WriteBits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.pos%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[len(w.data)-1] |= byte(v>>uint(i)&1) << (7 - uint(w.pos%8))
+		w.pos++
+	}
+}
+
+// WriteUE writes an unsigned integer of Exp-Golomb code, which is ue(v) in H.264 and H.265.
+func (w *Writer) WriteUE(v uint64) {
+	n := 0
+	for x := v + 1; x > 1; x >>= 1 {
+		n++
+	}
+	w.WriteBits(0, n)
+	w.WriteBits(v+1, n+1)
+}
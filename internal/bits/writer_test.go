@@ -0,0 +1,28 @@
+package bits
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	w := &Writer{}
+	w.WriteBits(5, 3)
+	for _, v := range []uint64{0, 1, 2, 3, 6, 7} {
+		w.WriteUE(v)
+	}
+	want := []byte{0xb4, 0xc8, 0x71, 0x00}
+	if !bytes.Equal(w.Bytes(), want) {
+		t.Fatalf("should be %#v, but got %#v", want, w.Bytes())
+	}
+
+	r := NewReader(w.Bytes())
+	if v, _ := r.ReadBits(3); v != 5 {
+		t.Errorf("should be 5, but got %d", v)
+	}
+	for _, want := range []uint{0, 1, 2, 3, 6, 7} {
+		if v, err := r.ReadUE(); err != nil || v != want {
+			t.Errorf("should be %d, but got %d (%v)", want, v, err)
+		}
+	}
+}
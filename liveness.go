@@ -0,0 +1,136 @@
+package rtmp
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+var (
+	errIdleTimeout         = errors.New("connection is idle")
+	errUnresponsiveTimeout = errors.New("connection does not respond to pings")
+)
+
+// idleTimeoutWriteTimeout limits the time to send NetConnection.Connect.IdleTimeout,
+// since the client may not read anymore.
+const idleTimeoutWriteTimeout = time.Second
+
+// RTT returns the round-trip time measured with the last PingResponse event.
+// It returns 0 if not measured yet.
+func (c *Conn) RTT() time.Duration {
+	c.rttMu.Lock()
+	defer c.rttMu.Unlock()
+	return c.rtt
+}
+
+// pingTimestamp returns the timestamp of PingRequest events, which is the elapsed time
+// since the connection is accepted in milliseconds.
+func (c *Conn) pingTimestamp() uint32 {
+	return uint32(time.Since(c.startTime) / time.Millisecond)
+}
+
+// ping sends PingRequest events every PingInterval until the connection is closed.
+func (c *Conn) ping() {
+	ticker := time.NewTicker(c.server.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			x, err := GenerateUserPingRequest(c.pingTimestamp())
+			if err != nil {
+				c.server.logf("Failed to generate PingRequest: %s", err)
+				return
+			}
+			if err = c.writeChunks(x); err != nil {
+				c.server.logf("Failed to send PingRequest: %s", err)
+				return
+			}
+		}
+	}
+}
+
+// touch records the time when a message is received from the client.
+func (c *Conn) touch() {
+	c.lastReadMu.Lock()
+	c.lastRead = time.Now()
+	c.lastReadMu.Unlock()
+}
+
+// unresponsive reports whether the connection is closed, or has received no messages for
+// PingInterval plus PingTimeout. It can be called from other goroutines.
+func (c *Conn) unresponsive() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+	}
+	if c.server.PingInterval <= 0 || c.server.PingTimeout <= 0 {
+		return false
+	}
+	c.lastReadMu.Lock()
+	defer c.lastReadMu.Unlock()
+	return time.Since(c.lastRead) > c.server.PingInterval+c.server.PingTimeout
+}
+
+// handlePingResponse measures the RTT with the timestamp of the PingRequest event. The response with
+// a timestamp in the future is ignored, since no PingRequest event has been sent with it.
+func (c *Conn) handlePingResponse(timestamp uint32) {
+	now := c.pingTimestamp()
+	if timestamp > now {
+		return
+	}
+	rtt := time.Duration(now-timestamp) * time.Millisecond
+	c.rttMu.Lock()
+	c.rtt = rtt
+	c.rttMu.Unlock()
+}
+
+// active reports whether the connection is publishing or playing a stream.
+func (c *Conn) active() bool {
+	for _, ns := range c.streams {
+		if ns.state != streamIdle {
+			return true
+		}
+	}
+	return false
+}
+
+// readDeadline returns the time until which the next message must be received. A client which
+// responds to pings sends a message at least every PingInterval, and a connection which is not
+// active becomes idle after IdleTimeout since the last message other than protocol control messages.
+func (c *Conn) readDeadline() time.Time {
+	var deadline time.Time
+	if c.server.PingInterval > 0 && c.server.PingTimeout > 0 {
+		deadline = time.Now().Add(c.server.PingInterval + c.server.PingTimeout)
+	}
+	if c.server.IdleTimeout > 0 && !c.active() {
+		idle := c.lastActive.Add(c.server.IdleTimeout)
+		if deadline.IsZero() || idle.Before(deadline) {
+			deadline = idle
+		}
+	}
+	return deadline
+}
+
+// timeout handles the read timeout. The connection is closed after this, since the partial
+// chunk may be read.
+func (c *Conn) timeout() error {
+	if c.server.IdleTimeout > 0 && !c.active() && time.Since(c.lastActive) >= c.server.IdleTimeout {
+		c.server.logf("Close the idle connection from %s", c.netconn.RemoteAddr())
+		c.netconn.SetWriteDeadline(time.Now().Add(idleTimeoutWriteTimeout))
+		err := c.writeCommand(0, newOnStatusMessage(CommandLevelStatus, CodeNetConnectIdleTimeout, "Connection idle timeout.").Bytes())
+		if err != nil {
+			c.server.logf("Failed to send %s: %s", CodeNetConnectIdleTimeout, err)
+		}
+		return errIdleTimeout
+	}
+	c.server.logf("Close the unresponsive connection from %s", c.netconn.RemoteAddr())
+	return errUnresponsiveTimeout
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
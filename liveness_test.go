@@ -0,0 +1,60 @@
+package rtmp
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zhangpeihao/goamf"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	serverSide, client := net.Pipe()
+	defer client.Close()
+	srv := &Server{IdleTimeout: 100 * time.Millisecond}
+	c := srv.newConn(serverSide)
+	errc := make(chan error, 1)
+	go func() { errc <- c.serve() }()
+
+	go func() {
+		client.Write(newChunkC0S0().Bytes())
+		client.Write(newChunkC1S1(0).Bytes())
+	}()
+	br := bufio.NewReader(client)
+	readC0S0(br)
+	s1, _ := readC1S1(br)
+	readC2S2(br)
+	client.Write(newChunkC2S2(s1).Bytes())
+
+	m, err := readChunk(br, make(map[uint32]*chunkStream), defaultChunkSize)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	buf := bytes.NewBuffer(m.payload)
+	amf.ReadString(buf)
+	amf.ReadDouble(buf)
+	amf.ReadValue(buf)
+	info, _ := amf.ReadValue(buf)
+	if obj, ok := info.(amf.Object); !ok || obj["code"] != CodeNetConnectIdleTimeout {
+		t.Errorf("should be %s, but got %#v", CodeNetConnectIdleTimeout, info)
+	}
+
+	if err = <-errc; err != errIdleTimeout {
+		t.Errorf("should be errIdleTimeout, but got %v", err)
+	}
+}
+
+func TestHandlePingResponse(t *testing.T) {
+	c := (&Server{}).newConn(nil)
+	c.startTime = time.Now().Add(-time.Second)
+	c.handlePingResponse(c.pingTimestamp() + 1000)
+	if rtt := c.RTT(); rtt != 0 {
+		t.Errorf("should ignore the timestamp in the future, but got %s", rtt)
+	}
+	c.handlePingResponse(500)
+	if rtt := c.RTT(); rtt < 500*time.Millisecond || rtt > time.Second {
+		t.Errorf("should be about 500ms, but got %s", rtt)
+	}
+}
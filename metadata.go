@@ -0,0 +1,113 @@
+package rtmp
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/zhangpeihao/goamf"
+)
+
+var errNotMetadata = errors.New("data message is not onMetaData")
+
+// Metadata is the onMetaData of a stream, which is sent by the publisher with @setDataFrame.
+// Fields are zero if not present.
+type Metadata struct {
+	Width           float64
+	Height          float64
+	FrameRate       float64
+	VideoCodecID    float64
+	VideoDataRate   float64 // in kbps
+	AudioCodecID    float64
+	AudioDataRate   float64 // in kbps
+	AudioSampleRate float64
+	AudioSampleSize float64
+	AudioChannels   float64
+	Stereo          bool
+	Duration        float64 // in seconds
+	FileSize        float64
+	Encoder         string
+
+	// Raw is the decoded onMetaData, including properties which are not typed.
+	Raw map[string]interface{}
+}
+
+func metadataNumber(raw map[string]interface{}, key string) float64 {
+	switch v := raw[key].(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+	}
+	return 0
+}
+
+// stripSetDataFrame removes the @setDataFrame wrapper of the data message. Players expect the
+// data message which begins with the handler name, like onMetaData.
+func stripSetDataFrame(payload []byte) ([]byte, bool) {
+	buf := bytes.NewBuffer(payload)
+	name, err := amf.ReadValue(buf)
+	if err != nil || name != "@setDataFrame" {
+		return payload, false
+	}
+	return buf.Bytes(), true
+}
+
+func isClearDataFrame(payload []byte) bool {
+	name, err := amf.ReadValue(bytes.NewBuffer(payload))
+	return err == nil && name == "@clearDataFrame"
+}
+
+// ReadMetadata parses the payload of an onMetaData data message, with or without the @setDataFrame wrapper.
+func ReadMetadata(payload []byte) (*Metadata, error) {
+	payload, _ = stripSetDataFrame(payload)
+	buf := bytes.NewBuffer(payload)
+	if name, err := amf.ReadValue(buf); err != nil || name != "onMetaData" {
+		return nil, errNotMetadata
+	}
+	v, err := amf.ReadValue(buf)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := v.(amf.Object)
+	if !ok {
+		return nil, errNotMetadata
+	}
+
+	md := &Metadata{
+		Width:           metadataNumber(raw, "width"),
+		Height:          metadataNumber(raw, "height"),
+		FrameRate:       metadataNumber(raw, "framerate"),
+		VideoCodecID:    metadataNumber(raw, "videocodecid"),
+		VideoDataRate:   metadataNumber(raw, "videodatarate"),
+		AudioCodecID:    metadataNumber(raw, "audiocodecid"),
+		AudioDataRate:   metadataNumber(raw, "audiodatarate"),
+		AudioSampleRate: metadataNumber(raw, "audiosamplerate"),
+		AudioSampleSize: metadataNumber(raw, "audiosamplesize"),
+		AudioChannels:   metadataNumber(raw, "audiochannels"),
+		Duration:        metadataNumber(raw, "duration"),
+		FileSize:        metadataNumber(raw, "filesize"),
+		Raw:             raw,
+	}
+	if md.FrameRate == 0 {
+		md.FrameRate = metadataNumber(raw, "fps")
+	}
+	md.Stereo, _ = raw["stereo"].(bool)
+	md.Encoder, _ = raw["encoder"].(string)
+	return md, nil
+}
+
+// Metadata returns the onMetaData of the live stream of the application, which is published with @setDataFrame.
+func (srv *Server) Metadata(app, name string) (*Metadata, bool) {
+	srv.mu.Lock()
+	ls, ok := srv.streams[streamKey{app: app, name: name}]
+	srv.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.metadata, ls.metadata != nil
+}
@@ -0,0 +1,45 @@
+package rtmp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/zhangpeihao/goamf"
+)
+
+func TestReadMetadata(t *testing.T) {
+	buf := new(bytes.Buffer)
+	amf.WriteValue(buf, "@setDataFrame")
+	amf.WriteValue(buf, "onMetaData")
+	amf.WriteValue(buf, map[string]interface{}{
+		"width":        1280,
+		"height":       720,
+		"framerate":    30,
+		"videocodecid": 7,
+		"stereo":       true,
+		"encoder":      "obs-output module",
+		"custom":       "value",
+	})
+
+	payload, ok := stripSetDataFrame(buf.Bytes())
+	if !ok {
+		t.Fatalf("@setDataFrame should be stripped")
+	}
+	if name, _ := amf.ReadValue(bytes.NewBuffer(payload)); name != "onMetaData" {
+		t.Errorf("should begin with onMetaData, but got %#v", name)
+	}
+
+	md, err := ReadMetadata(buf.Bytes())
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if md.Width != 1280 || md.Height != 720 || md.FrameRate != 30 || md.VideoCodecID != 7 {
+		t.Errorf("should be 1280x720 30fps (codec 7), but got %#v", md)
+	}
+	if !md.Stereo || md.Encoder != "obs-output module" {
+		t.Errorf("should be stereo and encoded by obs-output module, but got %#v", md)
+	}
+	if md.Raw["custom"] != "value" {
+		t.Errorf("raw metadata should be preserved, but got %#v", md.Raw)
+	}
+}
@@ -0,0 +1,223 @@
+package rtmp
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/zhangpeihao/goamf"
+)
+
+type playerControlType int
+
+const (
+	playerPause playerControlType = iota
+	playerUnpause
+	playerSeek
+)
+
+type playerControl struct {
+	typ      playerControlType
+	position uint32 // The position to seek in milliseconds.
+}
+
+// A filePlayer plays a recorded FLV file on a stream. Tags are sent in real time according to
+// their timestamps, by the goroutine which is started by start. Tags are sent ahead by the
+// buffer length of the player, so that its buffer is filled.
+type filePlayer struct {
+	ns   *netStream
+	file *os.File
+	tags []*flvTag
+
+	controls chan playerControl
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+func openFilePlayer(ns *netStream, path string) (*filePlayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	tags, _, err := readFLVTags(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &filePlayer{
+		ns:       ns,
+		file:     file,
+		tags:     tags,
+		controls: make(chan playerControl),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}, nil
+}
+
+// seekIndex returns the index of the tag to restart from for the position. It is the last
+// keyframe at or before the position, or the first tag at or after the position if the file
+// has no video.
+func (p *filePlayer) seekIndex(position uint32) int {
+	index := -1
+	hasVideo := false
+	for i, t := range p.tags {
+		if t.tagType != flvTagVideo {
+			continue
+		}
+		hasVideo = true
+		if t.timestamp > position {
+			break
+		}
+		if t.keyframe {
+			index = i
+		}
+	}
+	if hasVideo {
+		if index < 0 {
+			return 0
+		}
+		return index
+	}
+	for i, t := range p.tags {
+		if t.timestamp >= position {
+			return i
+		}
+	}
+	return len(p.tags)
+}
+
+func (p *filePlayer) start(position uint32) {
+	go p.run(p.seekIndex(position))
+}
+
+func (p *filePlayer) run(index int) {
+	defer close(p.stopped)
+
+	var (
+		paused    bool
+		completed bool
+		// The clock which maps timestamps of tags to the wall clock.
+		baseTime      time.Time
+		baseTimestamp uint32
+	)
+	resetClock := func() {
+		baseTime = time.Now()
+		if index < len(p.tags) {
+			baseTimestamp = p.tags[index].timestamp
+		}
+	}
+	resetClock()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		var next <-chan time.Time
+		if !paused && index < len(p.tags) {
+			t := p.tags[index]
+			wait := time.Duration(0)
+			if t.timestamp > baseTimestamp {
+				wait = time.Duration(t.timestamp-baseTimestamp)*time.Millisecond - time.Since(baseTime)
+				wait -= time.Duration(p.ns.getBufferLength()) * time.Millisecond
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+			next = timer.C
+		} else if !completed && index >= len(p.tags) {
+			completed = true
+			p.complete()
+		}
+
+		select {
+		case <-p.done:
+			return
+		case c := <-p.controls:
+			switch c.typ {
+			case playerPause:
+				paused = true
+			case playerUnpause:
+				paused = false
+				resetClock()
+			case playerSeek:
+				index = p.seekIndex(c.position)
+				completed = false
+				resetClock()
+				p.writeStatus(CommandLevelStatus, CodeNetStreamSeekNotify, fmt.Sprintf("Seeking %d (stream ID: %d).", c.position, p.ns.id))
+				p.writeStatus(CommandLevelStatus, CodeNetStreamPlayStart, fmt.Sprintf("Started playing %s.", p.ns.name))
+			}
+		case <-next:
+			if err := p.writeTag(p.tags[index]); err != nil {
+				p.ns.conn.server.logf("Failed to play %s: %s", p.ns.name, err)
+				return
+			}
+			index++
+		}
+	}
+}
+
+func (p *filePlayer) writeTag(t *flvTag) error {
+	data, err := t.readData(p.file)
+	if err != nil {
+		return err
+	}
+	m := &message{
+		timestamp: t.timestamp,
+		typeID:    MessageType(t.tagType),
+		streamID:  p.ns.id,
+		payload:   data,
+	}
+	if !p.ns.accept(m) {
+		return nil
+	}
+	return p.ns.writeMedia(m)
+}
+
+func (p *filePlayer) writeStatus(level CommandLevel, code CommandCode, description string) {
+	if err := p.ns.writeStatus(level, code, description); err != nil {
+		p.ns.conn.server.logf("Failed to send %s: %s", code, err)
+	}
+}
+
+// complete notifies the client that all tags are sent.
+func (p *filePlayer) complete() {
+	if eof, err := GenerateUserStreamEOF(p.ns.id); err == nil {
+		if err = p.ns.conn.writeChunks(eof); err != nil {
+			p.ns.conn.server.logf("Failed to send StreamEOF: %s", err)
+		}
+	}
+	buf := new(bytes.Buffer)
+	amf.WriteValue(buf, "onPlayStatus")
+	amf.WriteValue(buf, map[string]interface{}{
+		"level": CommandLevelStatus,
+		"code":  CodeNetStreamPlayComplete,
+	})
+	if err := p.ns.conn.writeMessage(chunkStreamIDData, MessageDataAMF0, p.ns.id, 0, buf.Bytes()); err != nil {
+		p.ns.conn.server.logf("Failed to send %s: %s", CodeNetStreamPlayComplete, err)
+	}
+	p.writeStatus(CommandLevelStatus, CodeNetStreamPlayStop, fmt.Sprintf("Stopped playing %s.", p.ns.name))
+}
+
+// control sends the control to the goroutine which plays the file.
+func (p *filePlayer) control(c playerControl) {
+	select {
+	case p.controls <- c:
+	case <-p.stopped:
+	}
+}
+
+// stop stops playing, and waits for the goroutine to exit.
+func (p *filePlayer) stop() {
+	close(p.done)
+	<-p.stopped
+	p.file.Close()
+}
@@ -0,0 +1,87 @@
+package rtmp
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilePlayerSeekIndex(t *testing.T) {
+	p := &filePlayer{
+		tags: []*flvTag{
+			{tagType: flvTagVideo, timestamp: 0, keyframe: true},
+			{tagType: flvTagAudio, timestamp: 0},
+			{tagType: flvTagVideo, timestamp: 40},
+			{tagType: flvTagVideo, timestamp: 80, keyframe: true},
+			{tagType: flvTagAudio, timestamp: 80},
+			{tagType: flvTagVideo, timestamp: 120},
+		},
+	}
+	for _, tt := range []struct {
+		position uint32
+		index    int
+	}{
+		{0, 0},
+		{79, 0},
+		{80, 3},
+		{1000, 3},
+	} {
+		if index := p.seekIndex(tt.position); index != tt.index {
+			t.Errorf("index of %d should be %d, but got %d", tt.position, tt.index, index)
+		}
+	}
+}
+
+func TestCloseStalledFilePlayer(t *testing.T) {
+	c, client := newConnectedTestConn()
+	defer client.Close()
+	path := filepath.Join(t.TempDir(), "cam.flv")
+	f, err := createFLVFile(path)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	f.writeTag(flvTagVideo, 0, []byte{0x17, 0x01, 0x00, 0x00, 0x00})
+	f.close()
+
+	ns := c.createStream()
+	ns.name = "cam"
+	ns.state = streamPlaying
+	if ns.player, err = openFilePlayer(ns, path); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	// The client reads only the first byte, so that the player is blocked writing the tag.
+	ns.player.start(0)
+	if _, err = client.Read(make([]byte, 1)); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		c.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatalf("connection should be closed while the player is blocked")
+	}
+}
+
+func TestPlayDVRRecording(t *testing.T) {
+	dir := t.TempDir()
+	srv := &Server{DVRPath: filepath.Join(dir, "{name}.flv")}
+	f, err := createFLVFile(filepath.Join(dir, "cam.flv"))
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	f.writeTag(flvTagVideo, 0, []byte{0x17, 0x01, 0x00, 0x00, 0x00})
+	f.close()
+	_, conn := newConnectedTestConnOf(srv)
+	defer conn.Close()
+	client := newPipeClient(t, conn)
+
+	// Only the files in RecordDir are played.
+	id := client.createStream(1)
+	client.command(id, "play", 0, nil, "cam", 0)
+	client.expectStatus(id, CodeNetStreamPlayStreamNotFound)
+}
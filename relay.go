@@ -0,0 +1,93 @@
+package rtmp
+
+import (
+	"errors"
+)
+
+var errSlowPlayer = errors.New("player is too slow to receive the live stream")
+
+// relayQueueSize limits the number of messages queued to a player of a live stream.
+// It is large enough for the headers and the GOP cache of usual streams.
+const relayQueueSize = 4096
+
+// A relay is the subscriber of a live stream for a player. Messages are queued and written on
+// its own goroutine, so that a slow player does not block the publisher and other subscribers.
+// A player which lets the queue overflow is disconnected.
+type relay struct {
+	ns       *netStream
+	messages chan *message
+	done     chan struct{}
+	// overflowed is guarded by ls.mu, as the other methods of subscribers.
+	overflowed bool
+}
+
+func newRelay(ns *netStream) *relay {
+	r := &relay{
+		ns:       ns,
+		messages: make(chan *message, relayQueueSize),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *relay) accept(m *message) bool {
+	return r.ns.accept(m)
+}
+
+func (r *relay) writeMedia(m *message) error {
+	return r.enqueue(m)
+}
+
+// writeStatus queues an onStatus command message, so that it is delivered in order with the media.
+func (r *relay) writeStatus(level CommandLevel, code CommandCode, description string) error {
+	return r.enqueue(&message{
+		typeID:  MessageCommandAMF0,
+		payload: newOnStatusMessage(level, code, description).Bytes(),
+	})
+}
+
+func (r *relay) enqueue(m *message) error {
+	if r.overflowed {
+		return nil
+	}
+	select {
+	case r.messages <- m:
+		return nil
+	default:
+		r.overflowed = true
+		r.ns.conn.netconn.Close()
+		return errSlowPlayer
+	}
+}
+
+// run writes the queued messages until the relay is stopped. The connection is closed on errors,
+// and the rest of the messages are discarded.
+func (r *relay) run() {
+	var err error
+	for {
+		select {
+		case <-r.done:
+			return
+		case m := <-r.messages:
+			if err != nil {
+				continue
+			}
+			if m.typeID == MessageCommandAMF0 {
+				err = r.ns.conn.writeCommand(r.ns.id, m.payload)
+			} else {
+				err = r.ns.writeMedia(m)
+			}
+			if err != nil {
+				r.ns.conn.server.logf("Failed to relay a message to stream %d: %s", r.ns.id, err)
+				r.ns.conn.netconn.Close()
+			}
+		}
+	}
+}
+
+// stop stops the goroutine of the relay. The queued messages are discarded.
+// It must be called after the relay is removed from the subscribers.
+func (r *relay) stop() {
+	close(r.done)
+}
@@ -0,0 +1,33 @@
+package rtmp
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRelaySlowPlayer(t *testing.T) {
+	c, client := newConnectedTestConn()
+	defer client.Close()
+	r := newRelay(&netStream{id: 1, conn: c})
+	defer r.stop()
+
+	// The client reads nothing, so that the first message blocks the relay and the others are queued.
+	m := &message{typeID: MessageVideo, payload: []byte{0x17, 0x01, 0x00, 0x00, 0x00}}
+	var err error
+	for i := 0; i < relayQueueSize+2 && err == nil; i++ {
+		err = r.writeMedia(m)
+	}
+	if err != errSlowPlayer {
+		t.Fatalf("should be errSlowPlayer, but got %v", err)
+	}
+	if err = r.writeMedia(m); err != nil {
+		t.Errorf("should be nil after the overflow, but got %s", err)
+	}
+
+	// The connection of the slow player should be closed.
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = io.Copy(io.Discard, client); err != nil {
+		t.Errorf("should be nil, but got %s", err)
+	}
+}
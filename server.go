@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"log"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -12,9 +13,100 @@ func ListenAndServe(addr string) error {
 	return server.ListenAndServe()
 }
 
+// A PublishConflictPolicy decides what happens when a client publishes to a stream name
+// which is already published by another stream.
+type PublishConflictPolicy int
+
+const (
+	// RejectNewPublisher rejects the new publisher with NetStream.Publish.BadName.
+	RejectNewPublisher PublishConflictPolicy = iota
+	// KickExistingPublisher closes the connection of the existing publisher, and lets the new one publish.
+	KickExistingPublisher
+)
+
 type Server struct {
 	Addr     string      // If empty, use ":1935".
 	ErrorLog *log.Logger // If nil, logging goes to os.Stderr.
+
+	// OnConnect, if not nil, is called in a new goroutine when a client is connected,
+	// for example to invoke methods of the client with Call.
+	OnConnect func(c *Conn)
+
+	// OnUserControl, if not nil, is called with User Control Messages received from clients.
+	// It is called from the goroutine which handles the connection.
+	OnUserControl func(c *Conn, e *UserControlEvent)
+
+	// DetectBandwidth enables the bandwidth detection after a client is connected.
+	// Clients can also request it with checkBandwidth regardless of this option.
+	DetectBandwidth bool
+
+	// OnBandwidth, if not nil, is called with the result of the bandwidth detection
+	// started by the server or requested by the client.
+	OnBandwidth func(c *Conn, bw *Bandwidth)
+
+	// RecordDir is the directory to save streams published with the record or append type.
+	// If empty, these streams are published without recording, and NetStream.Record.NoAccess is sent.
+	// The files in it are played and sought by players.
+	RecordDir string
+
+	// PingInterval is the interval to send PingRequest events to clients. The round-trip time
+	// is measured with PingResponse events, and is reported by Conn.RTT. If zero, no pings are sent.
+	PingInterval time.Duration
+
+	// PingTimeout is the time to wait for any message from a client after PingInterval. A client
+	// which sends nothing for PingInterval plus PingTimeout is disconnected. If zero, or if
+	// PingInterval is zero, unresponsive clients are not disconnected.
+	PingTimeout time.Duration
+
+	// IdleTimeout is the time after which a client which neither publishes nor plays a stream
+	// and sends no messages other than protocol control messages is disconnected, with
+	// NetConnection.Connect.IdleTimeout. It also limits the time of the handshake. If zero,
+	// idle clients are not disconnected.
+	IdleTimeout time.Duration
+
+	// GOPCache enables caching the messages since the last keyframe of live streams, which are
+	// sent to players when they start playing, so that they need not wait for the next keyframe.
+	GOPCache bool
+
+	// PublishConflict is the policy for publishing to a stream name which is already published.
+	// The default is RejectNewPublisher.
+	PublishConflict PublishConflictPolicy
+
+	// AllowReleaseStream, if not nil, decides whether the client c can release the stream name
+	// with the releaseStream command, when it is published by another connection which is still
+	// responsive. It can check the credentials of both connections, for example with TcURL.
+	// If nil, such requests are ignored. The publisher on a closed or unresponsive connection is
+	// always released.
+	AllowReleaseStream func(c *Conn, name string, publisher *Conn) bool
+
+	// DVRPath, if not empty, enables recording every published live stream to an FLV file.
+	// It is the template of the file path, in which {app}, {name} and {start} are replaced with
+	// the application name, the stream name and the time when the file started, like
+	// "/var/dvr/{app}/{name}-{start}.flv". {start} is formatted as "20060102-150405".
+	// {index} is replaced with the number of the file, which is incremented when the recording is
+	// rotated by DVRPolicies. The recordings are reported by OnRecording, and are not played with the
+	// play command, which plays only the files in RecordDir.
+	DVRPath string
+
+	// DVRPolicies are the recording policies for each application name, which override DVRPath.
+	// An application with a policy of the empty path is not recorded.
+	DVRPolicies map[string]DVRPolicy
+
+	// OnRecording, if not nil, is called when a file of a recording is completed, after the stream
+	// is unpublished, the recording is stopped, or the recording is rotated to a new file.
+	// A file without tags is removed instead.
+	OnRecording func(r *Recording)
+
+	// SharedObjectDir is the directory to save persistent remote shared objects.
+	// If empty, persistent shared objects are kept only in memory.
+	SharedObjectDir string
+
+	mu            sync.Mutex
+	streams       map[streamKey]*liveStream
+	callHandlers  map[string]CallHandlerFunc
+	sharedObjects map[string]*sharedObject
+	// finalizing is closed when the recording of the path is finalized.
+	finalizing map[string]chan struct{}
 }
 
 func (srv *Server) ListenAndServe() error {
@@ -57,8 +149,9 @@ func (srv *Server) Serve(l net.Listener) error {
 	}
 }
 
-func (srv *Server) newConn(nc net.Conn) *conn {
-	return &conn{
+func (srv *Server) newConn(nc net.Conn) *Conn {
+	now := time.Now()
+	return &Conn{
 		netconn:  nc,
 		server:   srv,
 		bufr:     bufio.NewReaderSize(nc, 1024*64),
@@ -66,6 +159,17 @@ func (srv *Server) newConn(nc net.Conn) *conn {
 		readbuf:  make([]byte, 4096),
 		writebuf: make([]byte, 4096),
 		state:    StateUninitialized,
+
+		chunkSize:      defaultChunkSize,
+		chunkStreams:   make(map[uint32]*chunkStream),
+		streams:        make(map[uint32]*netStream),
+		sharedObjects:  make(map[string]*sharedObject),
+		writeChunkSize: defaultChunkSize,
+
+		closed:     make(chan struct{}),
+		startTime:  now,
+		lastActive: now,
+		lastRead:   now,
 	}
 }
 
@@ -0,0 +1,494 @@
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/zhangpeihao/goamf"
+)
+
+type SharedObjectEventType uint8
+
+const (
+	SharedObjectUse           SharedObjectEventType = 1
+	SharedObjectRelease                             = 2
+	SharedObjectRequestChange                       = 3
+	SharedObjectChange                              = 4
+	SharedObjectSuccess                             = 5
+	SharedObjectSendMessage                         = 6
+	SharedObjectStatus                              = 7
+	SharedObjectClear                               = 8
+	SharedObjectRemove                              = 9
+	SharedObjectRequestRemove                       = 10
+	SharedObjectUseSuccess                          = 11
+)
+
+var errInvalidSharedObjectMessage = errors.New("invalid shared object message")
+
+// A SharedObjectEvent is an event of a shared object message.
+type SharedObjectEvent struct {
+	Type SharedObjectEventType
+	// Name is the property name of Request Change, Change, Success, Remove and Request Remove events.
+	Name string
+	// Value is the property value of Request Change and Change events.
+	Value interface{}
+	// Data is the raw event data. For Send Message and Status events, it contains AMF encoded values.
+	Data []byte
+}
+
+// A SharedObjectMessage is a message to use and to synchronize a remote shared object.
+//
+//	+------+------+-------+-----+-----+------+-----+ +-----+------+-----+
+//	|Header|Shared|Current|Flags|Event|Event |Event|.|Event|Event |Event|
+//	|      |Object|Version|     |Type |data  |data |.|Type |data  |data |
+//	|      |Name  |       |     |     |length|     |.|     |length|     |
+//	+------+------+-------+-----+-----+------+-----+ +-----+------+-----+
+//	       |                                                            |
+//	       |<- - - - - - - - - - - - - - - - - - - - - - - - - - - - - >|
+//	       |                  AMF Shared Object Message body            |
+type SharedObjectMessage struct {
+	Name       string
+	Version    uint32
+	Persistent bool
+	Events     []*SharedObjectEvent
+}
+
+func readUTF8(r *bytes.Reader) (string, error) {
+	var l uint16
+	if err := binary.Read(r, binary.BigEndian, &l); err != nil {
+		return "", err
+	}
+	if int(l) > r.Len() {
+		return "", io.ErrUnexpectedEOF
+	}
+	x := make([]byte, l)
+	if _, err := io.ReadFull(r, x); err != nil {
+		return "", err
+	}
+	return string(x), nil
+}
+
+func writeUTF8(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
+
+func readSharedObjectValue(buf *bytes.Buffer, objectEncoding uint) (interface{}, error) {
+	if objectEncoding == amf.AMF3 {
+		return amf.AMF3_ReadValue(buf)
+	}
+	return amf.ReadValue(buf)
+}
+
+func writeSharedObjectValue(buf *bytes.Buffer, objectEncoding uint, v interface{}) {
+	if objectEncoding == amf.AMF3 {
+		amf.AMF3_WriteValue(buf, v)
+		return
+	}
+	amf.WriteValue(buf, v)
+}
+
+// ReadSharedObjectMessage parses the payload of a shared object message. The values of
+// the properties are decoded in AMF0 or AMF3 according to the object encoding.
+func ReadSharedObjectMessage(payload []byte, objectEncoding uint) (*SharedObjectMessage, error) {
+	r := bytes.NewReader(payload)
+	name, err := readUTF8(r)
+	if err != nil {
+		return nil, errInvalidSharedObjectMessage
+	}
+	header := make([]byte, 12)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return nil, errInvalidSharedObjectMessage
+	}
+	m := &SharedObjectMessage{
+		Name:    name,
+		Version: binary.BigEndian.Uint32(header[:4]),
+		// The persistence is indicated by the flags. The remaining 4 bytes are reserved.
+		Persistent: binary.BigEndian.Uint32(header[4:8]) == 2,
+	}
+
+	for r.Len() > 0 {
+		eventHeader := make([]byte, 5)
+		if _, err = io.ReadFull(r, eventHeader); err != nil {
+			return nil, errInvalidSharedObjectMessage
+		}
+		// The length is checked before allocating, since it is sent by the client.
+		length := binary.BigEndian.Uint32(eventHeader[1:])
+		if length > uint32(r.Len()) {
+			return nil, errInvalidSharedObjectMessage
+		}
+		data := make([]byte, length)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, errInvalidSharedObjectMessage
+		}
+		e := &SharedObjectEvent{
+			Type: SharedObjectEventType(eventHeader[0]),
+			Data: data,
+		}
+
+		switch e.Type {
+		case SharedObjectRequestChange, SharedObjectChange:
+			dr := bytes.NewReader(data)
+			if e.Name, err = readUTF8(dr); err != nil {
+				return nil, errInvalidSharedObjectMessage
+			}
+			rest := make([]byte, dr.Len())
+			dr.Read(rest)
+			if e.Value, err = readSharedObjectValue(bytes.NewBuffer(rest), objectEncoding); err != nil {
+				return nil, err
+			}
+		case SharedObjectSuccess, SharedObjectRemove, SharedObjectRequestRemove:
+			if e.Name, err = readUTF8(bytes.NewReader(data)); err != nil {
+				return nil, errInvalidSharedObjectMessage
+			}
+		}
+		m.Events = append(m.Events, e)
+	}
+	return m, nil
+}
+
+// Bytes encodes the message. Data of Send Message and Status events is written as is.
+func (m *SharedObjectMessage) Bytes(objectEncoding uint) []byte {
+	buf := new(bytes.Buffer)
+	writeUTF8(buf, m.Name)
+	binary.Write(buf, binary.BigEndian, m.Version)
+	if m.Persistent {
+		binary.Write(buf, binary.BigEndian, uint32(2))
+	} else {
+		binary.Write(buf, binary.BigEndian, uint32(0))
+	}
+	binary.Write(buf, binary.BigEndian, uint32(0))
+
+	for _, e := range m.Events {
+		data := new(bytes.Buffer)
+		switch e.Type {
+		case SharedObjectRequestChange, SharedObjectChange:
+			writeUTF8(data, e.Name)
+			writeSharedObjectValue(data, objectEncoding, e.Value)
+		case SharedObjectSuccess, SharedObjectRemove, SharedObjectRequestRemove:
+			writeUTF8(data, e.Name)
+		default:
+			data.Write(e.Data)
+		}
+		buf.WriteByte(byte(e.Type))
+		binary.Write(buf, binary.BigEndian, uint32(data.Len()))
+		buf.Write(data.Bytes())
+	}
+	return buf.Bytes()
+}
+
+// A sharedObject is a remote shared object, which is shared by clients connected to the same application.
+type sharedObject struct {
+	app        string
+	name       string
+	persistent bool
+
+	mu          sync.Mutex
+	version     uint32
+	data        map[string]interface{}
+	subscribers map[*Conn]*sharedObjectClient
+}
+
+// sharedObjectQueueSize limits the number of messages queued to a client of a shared object.
+const sharedObjectQueueSize = 256
+
+var errSlowSharedObjectClient = errors.New("client is too slow to receive the shared object")
+
+// A sharedObjectClient is a client which uses a shared object. Messages are queued and written on
+// its own goroutine like relay, so that a slow client does not block the other clients of the
+// shared object. A client which lets the queue overflow is disconnected.
+type sharedObjectClient struct {
+	conn     *Conn
+	messages chan *message
+	done     chan struct{}
+	// overflowed is guarded by so.mu.
+	overflowed bool
+}
+
+func newSharedObjectClient(c *Conn) *sharedObjectClient {
+	sc := &sharedObjectClient{
+		conn:     c,
+		messages: make(chan *message, sharedObjectQueueSize),
+		done:     make(chan struct{}),
+	}
+	go sc.run()
+	return sc
+}
+
+func (sc *sharedObjectClient) enqueue(m *message) error {
+	if sc.overflowed {
+		return nil
+	}
+	select {
+	case sc.messages <- m:
+		return nil
+	default:
+		sc.overflowed = true
+		sc.conn.netconn.Close()
+		return errSlowSharedObjectClient
+	}
+}
+
+// run writes the queued messages until the client is stopped. The connection is closed on errors,
+// and the rest of the messages are discarded.
+func (sc *sharedObjectClient) run() {
+	var err error
+	for {
+		select {
+		case <-sc.done:
+			return
+		case m := <-sc.messages:
+			if err != nil {
+				continue
+			}
+			if err = sc.conn.writeMessage(chunkStreamIDCommand, m.typeID, 0, 0, m.payload); err != nil {
+				sc.conn.server.logf("Failed to send a shared object message: %s", err)
+				sc.conn.netconn.Close()
+			}
+		}
+	}
+}
+
+// stop stops the goroutine of the client. It must be called after the client is removed from the subscribers.
+func (sc *sharedObjectClient) stop() {
+	close(sc.done)
+}
+
+// write queues the events to the client in the object encoding of the client.
+// so.mu must be held.
+func (so *sharedObject) write(c *Conn, events []*SharedObjectEvent) error {
+	sc, ok := so.subscribers[c]
+	if !ok {
+		return nil
+	}
+	m := &SharedObjectMessage{
+		Name:       so.name,
+		Version:    so.version,
+		Persistent: so.persistent,
+		Events:     events,
+	}
+	if c.objectEncoding == amf.AMF3 {
+		payload := append([]byte{0x00}, m.Bytes(amf.AMF3)...)
+		return sc.enqueue(&message{typeID: MessageSharedObjectAMF3, payload: payload})
+	}
+	return sc.enqueue(&message{typeID: MessageSharedObjectAMF0, payload: m.Bytes(amf.AMF0)})
+}
+
+// broadcast sends the events to all clients which use the shared object, except for the given client.
+// so.mu must be held.
+func (so *sharedObject) broadcast(events []*SharedObjectEvent, except *Conn) {
+	for c := range so.subscribers {
+		if c == except {
+			continue
+		}
+		if err := so.write(c, events); err != nil {
+			c.server.logf("Failed to send events of shared object %s: %s", so.name, err)
+		}
+	}
+}
+
+// use adds the client to the subscribers, and sends the current properties to the client.
+func (so *sharedObject) use(c *Conn) error {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+
+	if _, ok := so.subscribers[c]; !ok {
+		so.subscribers[c] = newSharedObjectClient(c)
+	}
+	events := []*SharedObjectEvent{
+		{Type: SharedObjectUseSuccess},
+		{Type: SharedObjectClear},
+	}
+	for name, value := range so.data {
+		events = append(events, &SharedObjectEvent{Type: SharedObjectChange, Name: name, Value: value})
+	}
+	return so.write(c, events)
+}
+
+// handle applies the events which the client sent, and synchronizes the changes with all clients.
+func (so *sharedObject) handle(c *Conn, events []*SharedObjectEvent) error {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+
+	changed := false
+	for _, e := range events {
+		switch e.Type {
+		case SharedObjectRequestChange:
+			so.data[e.Name] = e.Value
+			so.version++
+			changed = true
+			if err := so.write(c, []*SharedObjectEvent{{Type: SharedObjectSuccess, Name: e.Name}}); err != nil {
+				return err
+			}
+			so.broadcast([]*SharedObjectEvent{{Type: SharedObjectChange, Name: e.Name, Value: e.Value}}, c)
+		case SharedObjectRequestRemove:
+			if _, ok := so.data[e.Name]; !ok {
+				continue
+			}
+			delete(so.data, e.Name)
+			so.version++
+			changed = true
+			so.broadcast([]*SharedObjectEvent{{Type: SharedObjectRemove, Name: e.Name}}, nil)
+		case SharedObjectSendMessage:
+			so.broadcast([]*SharedObjectEvent{e}, nil)
+		default:
+			c.server.logf("Catch unexpected shared object event (type: %d) of %s", e.Type, so.name)
+		}
+	}
+	if changed && so.persistent {
+		return c.server.saveSharedObject(so)
+	}
+	return nil
+}
+
+// sharedObjectPath returns the file path to persist the shared object.
+// The name is cleaned so that the file is not created outside of the directory.
+func (srv *Server) sharedObjectPath(app, name string) string {
+	return filepath.Join(srv.SharedObjectDir, filepath.Clean("/"+app), filepath.Clean("/"+name)+".so")
+}
+
+// saveSharedObject writes the version and the properties of the shared object in AMF0.
+// so.mu must be held.
+func (srv *Server) saveSharedObject(so *sharedObject) error {
+	if srv.SharedObjectDir == "" {
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	amf.WriteValue(buf, so.version)
+	if _, err := amf.WriteValue(buf, so.data); err != nil {
+		return err
+	}
+
+	path := srv.sharedObjectPath(so.app, so.name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// loadSharedObject reads the shared object written by saveSharedObject if exists.
+func (srv *Server) loadSharedObject(so *sharedObject) error {
+	if srv.SharedObjectDir == "" {
+		return nil
+	}
+	x, err := os.ReadFile(srv.sharedObjectPath(so.app, so.name))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	buf := bytes.NewBuffer(x)
+	version, err := amf.ReadDouble(buf)
+	if err != nil {
+		return err
+	}
+	v, err := amf.ReadValue(buf)
+	if err != nil {
+		return err
+	}
+	data, ok := v.(amf.Object)
+	if !ok {
+		return errInvalidSharedObjectMessage
+	}
+	so.version = uint32(version)
+	so.data = data
+	return nil
+}
+
+// useSharedObject adds the client to the subscribers of the shared object. The client subscribes
+// while srv.mu is held, so that the object is not discarded by releaseSharedObject in between.
+func (srv *Server) useSharedObject(c *Conn, name string, persistent bool) (*sharedObject, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	key := c.app + "/" + name
+	so, ok := srv.sharedObjects[key]
+	if !ok {
+		so = &sharedObject{
+			app:         c.app,
+			name:        name,
+			persistent:  persistent,
+			data:        make(map[string]interface{}),
+			subscribers: make(map[*Conn]*sharedObjectClient),
+		}
+		if persistent {
+			if err := srv.loadSharedObject(so); err != nil {
+				srv.logf("Failed to load shared object %s: %s", key, err)
+			}
+		}
+		if srv.sharedObjects == nil {
+			srv.sharedObjects = make(map[string]*sharedObject)
+		}
+		srv.sharedObjects[key] = so
+	}
+	return so, so.use(c)
+}
+
+// releaseSharedObject removes the client from the subscribers. The shared object which is not
+// persistent is discarded when no client uses it.
+func (srv *Server) releaseSharedObject(c *Conn, so *sharedObject) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	if sc, ok := so.subscribers[c]; ok {
+		delete(so.subscribers, c)
+		sc.stop()
+	}
+	if len(so.subscribers) == 0 && !so.persistent {
+		delete(srv.sharedObjects, so.app+"/"+so.name)
+	}
+}
+
+func (c *Conn) handleSharedObjectMessage(m *message) error {
+	payload := m.payload
+	objectEncoding := uint(amf.AMF0)
+	if m.typeID == MessageSharedObjectAMF3 {
+		if len(payload) == 0 {
+			return errInvalidSharedObjectMessage
+		}
+		payload = payload[1:]
+		objectEncoding = amf.AMF3
+	}
+	so, err := ReadSharedObjectMessage(payload, objectEncoding)
+	if err != nil {
+		return err
+	}
+
+	var events []*SharedObjectEvent
+	for _, e := range so.Events {
+		switch e.Type {
+		case SharedObjectUse:
+			if _, ok := c.sharedObjects[so.Name]; ok {
+				continue
+			}
+			o, err := c.server.useSharedObject(c, so.Name, so.Persistent)
+			c.sharedObjects[so.Name] = o
+			if err != nil {
+				return err
+			}
+		case SharedObjectRelease:
+			if o, ok := c.sharedObjects[so.Name]; ok {
+				delete(c.sharedObjects, so.Name)
+				c.server.releaseSharedObject(c, o)
+			}
+		default:
+			events = append(events, e)
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	o, ok := c.sharedObjects[so.Name]
+	if !ok {
+		c.server.logf("Catch events of shared object %s which is not used", so.Name)
+		return nil
+	}
+	return o.handle(c, events)
+}
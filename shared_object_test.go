@@ -0,0 +1,108 @@
+package rtmp
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zhangpeihao/goamf"
+)
+
+func TestSharedObjectMessage(t *testing.T) {
+	in := []byte{
+		0x00, 0x04, 0x63, 0x68, 0x61, 0x74, // name: "chat"
+		0x00, 0x00, 0x00, 0x01, // version
+		0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, // flags: persistent
+		0x01, 0x00, 0x00, 0x00, 0x00, // use
+		0x03, 0x00, 0x00, 0x00, 0x0a, 0x00, 0x03, 0x6d, 0x73, 0x67, 0x02, 0x00, 0x02, 0x68, 0x69, // request change: msg = "hi"
+	}
+	m, err := ReadSharedObjectMessage(in, amf.AMF0)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if m.Name != "chat" || m.Version != 1 || !m.Persistent {
+		t.Errorf("should be chat (version 1, persistent), but got %s (version %d, persistent %t)", m.Name, m.Version, m.Persistent)
+	}
+	if len(m.Events) != 2 {
+		t.Fatalf("should have 2 events, but got %d", len(m.Events))
+	}
+	if m.Events[0].Type != SharedObjectUse {
+		t.Errorf("should be use event, but got %d", m.Events[0].Type)
+	}
+	if e := m.Events[1]; e.Type != SharedObjectRequestChange || e.Name != "msg" || e.Value != "hi" {
+		t.Errorf("should be request change of msg, but got %#v", e)
+	}
+
+	if out := m.Bytes(amf.AMF0); !reflect.DeepEqual(out, in) {
+		t.Errorf("should be %#v, but got %#v", in, out)
+	}
+}
+
+func TestSharedObjectMessageOversizedEvent(t *testing.T) {
+	in := []byte{
+		0x00, 0x04, 0x63, 0x68, 0x61, 0x74, // name: "chat"
+		0x00, 0x00, 0x00, 0x01, // version
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // flags
+		0x03, 0xff, 0xff, 0xff, 0xff, 0x00, 0x03, // request change of 4 GiB
+	}
+	if _, err := ReadSharedObjectMessage(in, amf.AMF0); err != errInvalidSharedObjectMessage {
+		t.Errorf("should be errInvalidSharedObjectMessage, but got %v", err)
+	}
+}
+
+func TestSaveAndLoadSharedObject(t *testing.T) {
+	srv := &Server{SharedObjectDir: t.TempDir()}
+	so := &sharedObject{
+		app:        "live",
+		name:       "../chat",
+		persistent: true,
+		version:    3,
+		data:       map[string]interface{}{"msg": "hi"},
+	}
+	if err := srv.saveSharedObject(so); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+
+	loaded := &sharedObject{app: "live", name: "../chat", persistent: true}
+	if err := srv.loadSharedObject(loaded); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if loaded.version != 3 {
+		t.Errorf("version should be 3, but got %d", loaded.version)
+	}
+	if !reflect.DeepEqual(map[string]interface{}(loaded.data), so.data) {
+		t.Errorf("should be %#v, but got %#v", so.data, loaded.data)
+	}
+}
+
+func TestSharedObjectSlowClient(t *testing.T) {
+	c, client := newConnectedTestConn()
+	defer client.Close()
+	c.app = "live"
+	so, err := c.server.useSharedObject(c, "chat", false)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+
+	// The client reads nothing, so that the first message blocks the writer and the others are queued.
+	events := []*SharedObjectEvent{{Type: SharedObjectSendMessage, Data: []byte{0x05}}}
+	so.mu.Lock()
+	for i := 0; i < sharedObjectQueueSize+2 && err == nil; i++ {
+		err = so.write(c, events)
+	}
+	so.mu.Unlock()
+	if err != errSlowSharedObjectClient {
+		t.Fatalf("should be errSlowSharedObjectClient, but got %v", err)
+	}
+
+	// The connection of the slow client should be closed.
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = io.Copy(io.Discard, client); err != nil {
+		t.Errorf("should be nil, but got %s", err)
+	}
+	c.server.releaseSharedObject(c, so)
+	if len(c.server.sharedObjects) != 0 {
+		t.Errorf("the shared object should be discarded, but got %d", len(c.server.sharedObjects))
+	}
+}
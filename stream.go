@@ -0,0 +1,876 @@
+package rtmp
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var errStreamAlreadyPublished = errors.New("stream is already published")
+
+type streamState int
+
+const (
+	streamIdle streamState = iota
+	streamPublishing
+	streamPlaying
+)
+
+// Publishing types of the publish command.
+const (
+	publishLive          = "live"
+	publishRecord        = "record"
+	publishAppend        = "append"
+	publishAppendWithGap = "appendWithGap"
+)
+
+// A netStream is a channel of a connection, identified by a message stream ID,
+// through which the client publishes or plays a stream.
+type netStream struct {
+	id    uint32
+	conn  *Conn
+	state streamState
+	name  string
+	live  *liveStream
+	// publishType is the publishing type of the publish command.
+	publishType string
+
+	player *filePlayer
+	// relay is the subscriber of the live stream which is played.
+	relay *relay
+
+	// mu guards the delivery options of the playing stream, which are read while relaying
+	// messages from the publisher.
+	mu           sync.Mutex
+	paused       bool
+	noAudio      bool
+	noVideo      bool
+	waitKeyframe bool
+	// bufferLength is the buffer length of the player in milliseconds, which is told with
+	// the SetBufferLength event.
+	bufferLength uint32
+	// audioTrack and videoTrack are the tracks of multitrack packets to play, or allTracks.
+	audioTrack int
+	videoTrack int
+}
+
+// allTracks means that multitrack packets are delivered as is.
+const allTracks = -1
+
+// defaultTrack is the track delivered to players which do not support multitrack.
+const defaultTrack = 0
+
+// Start positions of the play command.
+const (
+	playLiveOrRecorded = -2
+	playLive           = -1
+)
+
+// writeStatus sends an onStatus command message on the stream.
+func (ns *netStream) writeStatus(level CommandLevel, code CommandCode, description string) error {
+	return ns.conn.writeCommand(ns.id, newOnStatusMessage(level, code, description).Bytes())
+}
+
+func (ns *netStream) publish(name, publishType string) error {
+	ns.publishType = publishType
+	ls, err := ns.conn.server.publishStream(name, ns)
+	if err == errStreamAlreadyPublished {
+		return ns.writeStatus(CommandLevelError, CodeNetStreamPublishBadName, fmt.Sprintf("%s is already publishing.", name))
+	} else if err != nil {
+		return err
+	}
+	ns.name = name
+	ns.live = ls
+	ns.state = streamPublishing
+
+	usb, err := GenerateUserStreamBegin(ns.id)
+	if err != nil {
+		return err
+	}
+	if err = ns.conn.writeChunks(usb); err != nil {
+		return err
+	}
+	err = ns.writeStatus(CommandLevelStatus, CodeNetStreamPublishStart, fmt.Sprintf("Publishing %s.", name))
+	if err != nil {
+		return err
+	}
+
+	switch publishType {
+	case publishRecord, publishAppend, publishAppendWithGap:
+		return ns.startRecording(publishType != publishRecord)
+	case publishLive:
+	default:
+		ns.conn.server.logf("Unknown publishing type %s of %s, which is published as live", publishType, name)
+	}
+	return nil
+}
+
+// recordsToRecordDir reports whether the stream is published with the record or append type to RecordDir,
+// in which case it is recorded by startRecording instead of the DVR policy.
+func (ns *netStream) recordsToRecordDir() bool {
+	switch ns.publishType {
+	case publishRecord, publishAppend, publishAppendWithGap:
+		return ns.conn.server.RecordDir != ""
+	}
+	return false
+}
+
+// startRecording starts recording the published stream to the FLV file named after the stream.
+// If appending, the file is continued from its last timestamp. The recording is finalized like
+// the DVR when the stream is unpublished or StopRecording is called.
+func (ns *netStream) startRecording(appending bool) error {
+	srv := ns.conn.server
+	if srv.RecordDir == "" {
+		return ns.writeStatus(CommandLevelError, CodeNetStreamRecordNoAccess, fmt.Sprintf("No access to record %s.", ns.name))
+	}
+
+	path := srv.recordPath(ns.name)
+	dvr, err := newRecordRecorder(ns, path, appending)
+	if err != nil {
+		srv.logf("Failed to open %s: %s", path, err)
+		return ns.writeStatus(CommandLevelError, CodeNetStreamRecordFailed, fmt.Sprintf("Failed to record %s.", ns.name))
+	}
+
+	ls := ns.live
+	ls.mu.Lock()
+	if ls.publisher != ns || ls.dvr != nil {
+		// The stream is unpublished, or recorded with StartRecording while opening the file.
+		ls.mu.Unlock()
+		return dvr.file.discard()
+	}
+	ls.dvr = dvr
+	ls.subscribers[dvr] = struct{}{}
+	ls.mu.Unlock()
+	return ns.writeStatus(CommandLevelStatus, CodeNetStreamRecordStart, fmt.Sprintf("Recording %s.", ns.name))
+}
+
+// play starts playing the live stream or the recorded file of the name. By default, the live
+// stream is played if it is published, otherwise the recorded file is played if exists.
+// A start position of playLive plays only the live stream, and a start position of 0 or
+// more plays only the recorded file from the position in milliseconds.
+//
+// The stream name can have the query of the tracks to play, like "name?audioTrack=1&videoTrack=0".
+//
+// Recorded files are found only in RecordDir. The recordings of DVRPath and DVRPolicies are not played,
+// since a stream name does not identify one of them, whose paths have the start time, the index and
+// the suffix of the file. Playing them is rejected with NetStream.Play.StreamNotFound.
+func (ns *netStream) play(name string, start float64) error {
+	name, query := splitStreamName(name)
+	audioTrack, videoTrack := ns.conn.trackSelection(query)
+
+	var player *filePlayer
+	if start != playLive && (start >= 0 || !ns.conn.server.isPublished(ns.conn.app, name)) {
+		path := ns.conn.server.recordPath(name)
+		if _, err := os.Stat(path); path != "" && err == nil {
+			if player, err = openFilePlayer(ns, path); err != nil {
+				ns.conn.server.logf("Failed to open %s: %s", path, err)
+			}
+		}
+		if player == nil && start >= 0 {
+			return ns.writeStatus(CommandLevelError, CodeNetStreamPlayStreamNotFound, fmt.Sprintf("Failed to play %s; stream not found.", name))
+		}
+	}
+
+	ns.name = name
+	ns.state = streamPlaying
+	ns.mu.Lock()
+	ns.paused = false
+	ns.waitKeyframe = true
+	ns.audioTrack = audioTrack
+	ns.videoTrack = videoTrack
+	ns.mu.Unlock()
+	ns.live = nil
+
+	usb, err := GenerateUserStreamBegin(ns.id)
+	if err != nil {
+		return err
+	}
+	if err = ns.conn.writeChunks(usb); err != nil {
+		return err
+	}
+	if player != nil {
+		sir, err := GenerateUserStreamIsRecorded(ns.id)
+		if err != nil {
+			return err
+		}
+		if err = ns.conn.writeChunks(sir); err != nil {
+			return err
+		}
+	}
+	err = ns.writeStatus(CommandLevelStatus, CodeNetStreamPlayReset, fmt.Sprintf("Playing and resetting %s.", name))
+	if err != nil {
+		return err
+	}
+	err = ns.writeStatus(CommandLevelStatus, CodeNetStreamPlayStart, fmt.Sprintf("Started playing %s.", name))
+	if err != nil {
+		return err
+	}
+	if player == nil {
+		// Subscribe after the status messages, since the metadata of the stream is sent on subscribing.
+		ns.live = ns.conn.server.subscribeStream(name, ns)
+		return nil
+	}
+	ns.player = player
+	if start < 0 {
+		start = 0
+	}
+	player.start(uint32(start))
+	return nil
+}
+
+// splitStreamName splits the stream name and the query string.
+func splitStreamName(name string) (string, string) {
+	if i := strings.IndexByte(name, '?'); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
+
+// trackSelection returns the audio and video tracks to play, which are selected by the query.
+// If a track is not selected, players which support multitrack get all tracks, and the others
+// get the default track.
+func (c *Conn) trackSelection(query string) (audioTrack, videoTrack int) {
+	audioTrack, videoTrack = allTracks, allTracks
+	if c.capsEx&CapsExMultitrack == 0 {
+		audioTrack, videoTrack = defaultTrack, defaultTrack
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return audioTrack, videoTrack
+	}
+	if id, err := strconv.ParseUint(values.Get("audioTrack"), 10, 8); err == nil {
+		audioTrack = int(id)
+	}
+	if id, err := strconv.ParseUint(values.Get("videoTrack"), 10, 8); err == nil {
+		videoTrack = int(id)
+	}
+	return audioTrack, videoTrack
+}
+
+// pause stops or resumes delivering messages. The live stream is resumed from the next keyframe.
+func (ns *netStream) pause(pause bool) error {
+	if ns.state != streamPlaying {
+		return nil
+	}
+	ns.mu.Lock()
+	ns.paused = pause
+	if !pause && ns.player == nil {
+		ns.waitKeyframe = true
+	}
+	ns.mu.Unlock()
+
+	if pause {
+		if ns.player != nil {
+			ns.player.control(playerControl{typ: playerPause})
+		}
+		return ns.writeStatus(CommandLevelStatus, CodeNetStreamPauseNotify, fmt.Sprintf("Pausing %s.", ns.name))
+	}
+	if ns.player != nil {
+		ns.player.control(playerControl{typ: playerUnpause})
+	}
+	return ns.writeStatus(CommandLevelStatus, CodeNetStreamUnpauseNotify, fmt.Sprintf("Unpausing %s.", ns.name))
+}
+
+// receiveAudio enables or disables delivering audio messages to the player.
+func (ns *netStream) receiveAudio(receive bool) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.noAudio = !receive
+}
+
+// receiveVideo enables or disables delivering video messages to the player.
+// Video is resumed from the next keyframe.
+func (ns *netStream) receiveVideo(receive bool) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if receive && ns.noVideo {
+		ns.waitKeyframe = true
+	}
+	ns.noVideo = !receive
+}
+
+// seek moves the position of the recorded file to the keyframe at or before the position in milliseconds.
+// Live streams cannot be seeked.
+func (ns *netStream) seek(position float64) error {
+	if ns.state != streamPlaying || ns.player == nil {
+		return ns.writeStatus(CommandLevelError, CodeNetStreamSeekFailed, fmt.Sprintf("Failed to seek %s.", ns.name))
+	}
+	if position < 0 {
+		position = 0
+	}
+	ns.player.control(playerControl{typ: playerSeek, position: uint32(position)})
+	return nil
+}
+
+func (ns *netStream) setBufferLength(bufferLength uint32) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.bufferLength = bufferLength
+}
+
+func (ns *netStream) getBufferLength() uint32 {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return ns.bufferLength
+}
+
+// accept reports whether the message should be delivered to the player.
+func (ns *netStream) accept(m *message) bool {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	if ns.paused && ns.player == nil {
+		return false
+	}
+	switch m.typeID {
+	case MessageAudio:
+		return !ns.noAudio
+	case MessageVideo:
+		if ns.noVideo {
+			return false
+		}
+		if ns.waitKeyframe {
+			p, err := ReadVideoPacket(m.timestamp, m.payload)
+			if err != nil {
+				return false
+			}
+			// Sequence headers are needed to decode the keyframe.
+			if p.IsSequenceHeader() {
+				return true
+			}
+			if !p.IsKeyframe() {
+				return false
+			}
+			ns.waitKeyframe = false
+		}
+	}
+	return true
+}
+
+// close stops publishing or playing. The stream itself is kept,
+// so that the client can publish or play again on it.
+func (ns *netStream) close() error {
+	state := ns.state
+	ns.state = streamIdle
+	switch state {
+	case streamPublishing:
+		// NetStream.Record.Stop is sent when the recording is finalized.
+		ns.conn.server.unpublishStream(ns.name, ns)
+		return ns.writeStatus(CommandLevelStatus, CodeNetStreamUnpublishSuccess, fmt.Sprintf("%s is now unpublished.", ns.name))
+	case streamPlaying:
+		if ns.player != nil {
+			ns.player.stop()
+			ns.player = nil
+			return nil
+		}
+		ns.conn.server.unsubscribeStream(ns.name, ns)
+	}
+	return nil
+}
+
+// writeMedia relays an audio, video or data message of the live stream to the player.
+// Only the selected track of multitrack packets is relayed.
+func (ns *netStream) writeMedia(m *message) error {
+	ns.mu.Lock()
+	audioTrack, videoTrack := ns.audioTrack, ns.videoTrack
+	ns.mu.Unlock()
+
+	var csid uint32
+	trackID := allTracks
+	switch m.typeID {
+	case MessageAudio:
+		csid = chunkStreamIDAudio
+		trackID = audioTrack
+	case MessageVideo:
+		csid = chunkStreamIDVideo
+		trackID = videoTrack
+	default:
+		csid = chunkStreamIDData
+	}
+	payload := m.payload
+	if trackID != allTracks {
+		var ok bool
+		if payload, ok = selectTrack(m.typeID, payload, uint8(trackID)); !ok {
+			return nil
+		}
+	}
+	return ns.conn.writeMessage(csid, m.typeID, ns.id, m.timestamp, payload)
+}
+
+// A streamRecorder writes the audio, video and data messages of a publishing stream to an FLV file.
+// Timestamps are rebased so that the recording starts at the offset.
+type streamRecorder struct {
+	file   *flvFile
+	offset uint32
+
+	started bool
+	base    uint32
+}
+
+func (r *streamRecorder) write(m *message) error {
+	var tagType uint8
+	switch m.typeID {
+	case MessageAudio:
+		tagType = flvTagAudio
+	case MessageVideo:
+		tagType = flvTagVideo
+	case MessageDataAMF0:
+		tagType = flvTagScript
+	default:
+		return nil
+	}
+
+	if !r.started {
+		r.base = m.timestamp
+		r.started = true
+	}
+	timestamp := r.offset
+	if m.timestamp > r.base {
+		timestamp += m.timestamp - r.base
+	}
+	return r.file.writeTag(tagType, timestamp, m.payload)
+}
+
+// A subscriber receives the messages of a live stream, like the relay of a player and a recorder.
+// The methods are called with ls.mu held, so that they must not block on clients.
+type subscriber interface {
+	// accept reports whether the message should be delivered to the subscriber.
+	accept(m *message) bool
+	writeMedia(m *message) error
+	writeStatus(level CommandLevel, code CommandCode, description string) error
+}
+
+// A liveStream represents a stream which is published to the server, or
+// which players are waiting for.
+type liveStream struct {
+	app    string
+	name   string
+	server *Server
+
+	mu sync.Mutex
+	// publisher is guarded by both srv.mu and ls.mu, so that it can be read with either of them.
+	publisher   *netStream
+	subscribers map[subscriber]struct{}
+	// dvr records the stream while it is published, which is one of the subscribers.
+	dvr *dvrRecorder
+
+	// metadata is set by the publisher with @setDataFrame, and metadataMessage is the data message
+	// without the @setDataFrame wrapper, which is sent to players when they subscribe.
+	metadata        *Metadata
+	metadataMessage *message
+
+	// audioSequenceHeaders and videoSequenceHeaders are sent to players when they subscribe.
+	audioSequenceHeaders sequenceHeaders
+	videoSequenceHeaders sequenceHeaders
+	// audioInfo and videoInfo are decoded from the sequence headers.
+	audioInfo *AudioInfo
+	videoInfo *VideoInfo
+
+	// gop is the messages since the last keyframe, which are sent to players when they subscribe
+	// so that they can start playing immediately. It is used if gopCache is true.
+	gopCache bool
+	gop      []*message
+	gopSize  int
+}
+
+// maxGOPCacheSize limits the size of the GOP cache. If a GOP exceeds it, the cache is
+// discarded until the next keyframe.
+const maxGOPCacheSize = 16 * 1024 * 1024
+
+// cacheGOP adds the message to the GOP cache. A keyframe starts a new GOP.
+// ls.mu must be held.
+func (ls *liveStream) cacheGOP(m *message, keyframe bool) {
+	if !ls.gopCache {
+		return
+	}
+	if keyframe {
+		ls.gop = nil
+		ls.gopSize = 0
+	} else if ls.gop == nil {
+		return
+	}
+	ls.gopSize += len(m.payload)
+	if ls.gopSize > maxGOPCacheSize {
+		ls.gop = nil
+		ls.gopSize = 0
+		return
+	}
+	ls.gop = append(ls.gop, m)
+}
+
+// resetHeaders discards the metadata, the sequence headers and the GOP cache of the previous publisher.
+// ls.mu must be held.
+func (ls *liveStream) resetHeaders() {
+	ls.metadata = nil
+	ls.metadataMessage = nil
+	ls.audioSequenceHeaders = nil
+	ls.videoSequenceHeaders = nil
+	ls.audioInfo = nil
+	ls.videoInfo = nil
+	ls.gop = nil
+	ls.gopSize = 0
+}
+
+// headers returns the metadata and the sequence headers, which are sent before other messages
+// so that the stream can be decoded. ls.mu must be held.
+func (ls *liveStream) headers() []*message {
+	var headers []*message
+	if ls.metadataMessage != nil {
+		headers = append(headers, ls.metadataMessage)
+	}
+	headers = append(headers, ls.audioSequenceHeaders.messages()...)
+	return append(headers, ls.videoSequenceHeaders.messages()...)
+}
+
+// handleMessage handles the audio, video or data message from the publisher, and relays it to the
+// subscribers. The caches are updated in the same critical section as the relay, so that a subscriber
+// which subscribes in between does not receive the message from both the GOP cache and the relay.
+// Messages from the publisher which was kicked by another publisher are dropped.
+func (ls *liveStream) handleMessage(from *netStream, m *message) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if ls.publisher != from {
+		return
+	}
+	switch m.typeID {
+	case MessageAudio:
+		if err := ls.handleAudio(m); err != nil {
+			ls.server.logf("Failed to parse an audio message of %s: %s", ls.name, err)
+		}
+	case MessageVideo:
+		if err := ls.handleVideo(m); err != nil {
+			ls.server.logf("Failed to parse a video message of %s: %s", ls.name, err)
+		}
+	case MessageDataAMF0:
+		var ok bool
+		if m, ok = ls.setDataFrame(m); !ok {
+			return
+		}
+	}
+	ls.broadcast(m)
+}
+
+// handleAudio inspects the audio message from the publisher, and caches the sequence header.
+// ls.mu must be held.
+func (ls *liveStream) handleAudio(m *message) error {
+	p, err := ReadAudioPacket(m.payload)
+	if err != nil {
+		return err
+	}
+	// The audio information is of the default track. Formats without sequence headers have
+	// the information in every packet, so that it is read from the first packet.
+	t := p.track(defaultTrack)
+	if p.IsSequenceHeader() {
+		ls.audioSequenceHeaders.set(m, p.trackIDs())
+		if t != nil {
+			ls.audioInfo, err = readAudioInfo(t)
+		}
+	} else {
+		if ls.audioInfo == nil && !p.hasSequenceHeader() {
+			ls.audioInfo, err = readAudioInfo(p)
+		}
+		ls.cacheGOP(m, false)
+	}
+	return err
+}
+
+// handleVideo inspects the video message from the publisher, and caches the sequence header and the GOP.
+// ls.mu must be held.
+func (ls *liveStream) handleVideo(m *message) error {
+	p, err := ReadVideoPacket(m.timestamp, m.payload)
+	if err != nil {
+		return err
+	}
+	// The video information is of the default track.
+	t := p.track(defaultTrack)
+	if p.IsSequenceHeader() {
+		ls.videoSequenceHeaders.set(m, p.trackIDs())
+		if t != nil {
+			ls.videoInfo, err = readVideoInfo(t)
+		}
+	} else {
+		ls.cacheGOP(m, p.IsKeyframe())
+	}
+	return err
+}
+
+// sequenceHeaders are the latest sequence headers for each track. Packets without multiple tracks
+// are for the default track.
+type sequenceHeaders map[uint8]*message
+
+// set caches the sequence header for the tracks.
+func (h *sequenceHeaders) set(m *message, trackIDs []uint8) {
+	if *h == nil {
+		*h = make(sequenceHeaders)
+	}
+	for _, id := range trackIDs {
+		(*h)[id] = m
+	}
+}
+
+// messages returns the sequence headers in the order of the track IDs. A message which has
+// the sequence headers of multiple tracks is returned once.
+func (h sequenceHeaders) messages() []*message {
+	ids := make([]int, 0, len(h))
+	for id := range h {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+
+	var messages []*message
+	seen := make(map[*message]bool)
+	for _, id := range ids {
+		m := h[uint8(id)]
+		if !seen[m] {
+			seen[m] = true
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
+
+// setDataFrame handles the data message from the publisher. It caches onMetaData sent with
+// @setDataFrame, and clears it with @clearDataFrame. It returns the message to relay to players.
+// ls.mu must be held.
+func (ls *liveStream) setDataFrame(m *message) (*message, bool) {
+	if isClearDataFrame(m.payload) {
+		ls.metadata = nil
+		ls.metadataMessage = nil
+		return nil, false
+	}
+	payload, ok := stripSetDataFrame(m.payload)
+	if !ok {
+		return m, true
+	}
+	stripped := &message{
+		chunkStreamID: m.chunkStreamID,
+		timestamp:     m.timestamp,
+		typeID:        m.typeID,
+		streamID:      m.streamID,
+		payload:       payload,
+	}
+	if md, err := ReadMetadata(payload); err == nil {
+		ls.metadata = md
+		ls.metadataMessage = stripped
+	}
+	return stripped, true
+}
+
+// broadcast relays the message from the publisher to all subscribers. ls.mu must be held.
+func (ls *liveStream) broadcast(m *message) {
+	for s := range ls.subscribers {
+		if !s.accept(m) {
+			continue
+		}
+		if err := s.writeMedia(m); err != nil {
+			ls.server.logf("Failed to relay a message of %s: %s", ls.name, err)
+		}
+	}
+}
+
+func (ls *liveStream) notify(level CommandLevel, code CommandCode, description string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for s := range ls.subscribers {
+		if err := s.writeStatus(level, code, description); err != nil {
+			ls.server.logf("Failed to notify %s of %s: %s", code, ls.name, err)
+		}
+	}
+}
+
+// A streamKey identifies a live stream, whose name is unique in the application.
+type streamKey struct {
+	app  string
+	name string
+}
+
+func (srv *Server) liveStream(app, name string) *liveStream {
+	if srv.streams == nil {
+		srv.streams = make(map[streamKey]*liveStream)
+	}
+	key := streamKey{app: app, name: name}
+	ls, ok := srv.streams[key]
+	if !ok {
+		ls = &liveStream{
+			app:         app,
+			name:        name,
+			server:      srv,
+			subscribers: make(map[subscriber]struct{}),
+			gopCache:    srv.GOPCache,
+		}
+		srv.streams[key] = ls
+	}
+	return ls
+}
+
+// publishStream registers ns as the publisher of the stream. If the stream is already published,
+// the existing publisher is kicked or ns is rejected according to the PublishConflict policy.
+func (srv *Server) publishStream(name string, ns *netStream) (*liveStream, error) {
+	srv.mu.Lock()
+	ls := srv.liveStream(ns.conn.app, name)
+	old := ls.publisher
+	if old == ns {
+		old = nil
+	}
+	if old != nil && srv.PublishConflict != KickExistingPublisher {
+		srv.mu.Unlock()
+		return nil, errStreamAlreadyPublished
+	}
+	ls.mu.Lock()
+	ls.publisher = ns
+	ls.resetHeaders()
+	dvr := ls.stopDVR()
+	ls.mu.Unlock()
+	srv.mu.Unlock()
+
+	if old != nil {
+		srv.kickPublisher(name, old, ns.conn)
+	}
+	srv.closeDVR(ls.name, dvr)
+	srv.startDVR(ls, ns)
+	ls.notify(CommandLevelStatus, CodeNetStreamPlayPublishNotify, fmt.Sprintf("%s is now published.", name))
+	return ls, nil
+}
+
+// unpublishStream releases the stream name if ns is the publisher of the stream,
+// and notifies subscribers that the stream was unpublished.
+func (srv *Server) unpublishStream(name string, ns *netStream) {
+	srv.mu.Lock()
+	ls, ok := srv.streams[streamKey{app: ns.conn.app, name: name}]
+	if !ok || ls.publisher != ns {
+		srv.mu.Unlock()
+		return
+	}
+	ls.mu.Lock()
+	ls.publisher = nil
+	ls.resetHeaders()
+	dvr := ls.stopDVR()
+	ls.mu.Unlock()
+	srv.removeIfUnused(ls)
+	srv.mu.Unlock()
+
+	srv.closeDVR(name, dvr)
+
+	ls.notify(CommandLevelStatus, CodeNetStreamPlayUnpublishNotify, fmt.Sprintf("%s is now unpublished.", name))
+}
+
+// kickPublisher stops the publisher which lost the stream name. The publisher on another
+// connection is stopped by closing the connection, since its state is owned by the goroutine
+// which handles the connection. c is the connection which requests it.
+func (srv *Server) kickPublisher(name string, ns *netStream, c *Conn) {
+	srv.logf("Kick the publisher of %s on stream %d", name, ns.id)
+	if ns.conn == c {
+		if err := ns.close(); err != nil {
+			srv.logf("Failed to close stream %d: %s", ns.id, err)
+		}
+		return
+	}
+	ns.conn.netconn.Close()
+}
+
+// releaseStream kicks the publisher of the stream if it is on the same connection, or its connection
+// is closed or unresponsive. It lets an encoder publish again when its previous connection is not
+// closed yet. The publisher on another live connection is kicked only if AllowReleaseStream allows it.
+func (srv *Server) releaseStream(name string, c *Conn) {
+	srv.mu.Lock()
+	var publisher *netStream
+	if ls, ok := srv.streams[streamKey{app: c.app, name: name}]; ok {
+		publisher = ls.publisher
+	}
+	srv.mu.Unlock()
+
+	if publisher == nil {
+		return
+	}
+	if publisher.conn != c && !publisher.conn.unresponsive() &&
+		(srv.AllowReleaseStream == nil || !srv.AllowReleaseStream(c, name, publisher.conn)) {
+		srv.logf("Cannot release %s which is published by another connection", name)
+		return
+	}
+	srv.unpublishStream(name, publisher)
+	srv.kickPublisher(name, publisher, c)
+}
+
+// isPublished reports whether the stream of the application is published.
+func (srv *Server) isPublished(app, name string) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	ls, ok := srv.streams[streamKey{app: app, name: name}]
+	return ok && ls.publisher != nil
+}
+
+// recordPath returns the path of the FLV file to record the stream. The name is cleaned
+// so that the file is not created outside of RecordDir. It returns "" if RecordDir is empty.
+func (srv *Server) recordPath(name string) string {
+	if srv.RecordDir == "" {
+		return ""
+	}
+	return filepath.Join(srv.RecordDir, filepath.Clean("/"+name)+".flv")
+}
+
+// subscribeStream adds the relay of ns to the subscribers of the stream.
+// Players can subscribe to a stream before it is published.
+func (srv *Server) subscribeStream(name string, ns *netStream) *liveStream {
+	srv.mu.Lock()
+	ls := srv.liveStream(ns.conn.app, name)
+	ls.mu.Lock()
+	srv.mu.Unlock()
+	defer ls.mu.Unlock()
+
+	ns.relay = newRelay(ns)
+	ls.subscribers[ns.relay] = struct{}{}
+	for _, m := range ls.headers() {
+		if err := ns.relay.writeMedia(m); err != nil {
+			srv.logf("Failed to send the headers of %s: %s", name, err)
+		}
+	}
+	for _, m := range ls.gop {
+		if !ns.accept(m) {
+			continue
+		}
+		if err := ns.relay.writeMedia(m); err != nil {
+			srv.logf("Failed to send the GOP cache of %s: %s", name, err)
+			break
+		}
+	}
+	return ls
+}
+
+func (srv *Server) unsubscribeStream(name string, ns *netStream) {
+	r := ns.relay
+	if r == nil {
+		return
+	}
+	ns.relay = nil
+	defer r.stop()
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	ls, ok := srv.streams[streamKey{app: ns.conn.app, name: name}]
+	if !ok {
+		return
+	}
+	ls.mu.Lock()
+	delete(ls.subscribers, r)
+	ls.mu.Unlock()
+	srv.removeIfUnused(ls)
+}
+
+// removeIfUnused removes the stream which has neither a publisher nor subscribers.
+// srv.mu must be held.
+func (srv *Server) removeIfUnused(ls *liveStream) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.publisher == nil && len(ls.subscribers) == 0 {
+		delete(srv.streams, streamKey{app: ls.app, name: ls.name})
+	}
+}
@@ -0,0 +1,296 @@
+package rtmp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zhangpeihao/goamf"
+)
+
+func TestPublishConflict(t *testing.T) {
+	srv := &Server{}
+	_, conn1 := newConnectedTestConnOf(srv)
+	defer conn1.Close()
+	_, conn2 := newConnectedTestConnOf(srv)
+	defer conn2.Close()
+	pub1 := newPipeClient(t, conn1)
+	pub2 := newPipeClient(t, conn2)
+
+	id1 := pub1.createStream(1)
+	pub1.command(id1, "publish", 0, nil, "live", "live")
+	pub1.expectStatus(id1, CodeNetStreamPublishStart)
+
+	id2 := pub2.createStream(1)
+	pub2.command(id2, "publish", 0, nil, "live", "live")
+	pub2.expectStatus(id2, CodeNetStreamPublishBadName)
+
+	srv.PublishConflict = KickExistingPublisher
+	pub2.command(id2, "publish", 0, nil, "live", "live")
+	pub2.expectStatus(id2, CodeNetStreamPublishStart)
+	// The connection of the kicked publisher should be closed.
+	expectClosed(t, pub1)
+}
+
+func TestKickedPublisherMessages(t *testing.T) {
+	c1, client1 := newConnectedTestConn()
+	defer client1.Close()
+	srv := c1.server
+	srv.PublishConflict = KickExistingPublisher
+	c2, client2 := newConnectedTestConnOf(srv)
+	defer client2.Close()
+	old := &netStream{id: 1, conn: c1}
+	ns := &netStream{id: 1, conn: c2}
+	if _, err := srv.publishStream("live", old); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	ls, err := srv.publishStream("live", ns)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+
+	// Messages which the kicked publisher has sent before its connection is closed are ignored.
+	metadata := new(bytes.Buffer)
+	writeAMF0Value(metadata, "@setDataFrame")
+	writeAMF0Value(metadata, "onMetaData")
+	writeAMF0Value(metadata, map[string]interface{}{"width": 1280.0})
+	ls.handleMessage(old, &message{typeID: MessageDataAMF0, payload: metadata.Bytes()})
+	ls.handleMessage(old, &message{typeID: MessageVideo, payload: testAVCSequenceHeader})
+	ls.handleMessage(old, &message{typeID: MessageAudio, payload: []byte{0xaf, 0x00, 0x12, 0x10}})
+	if len(ls.headers()) != 0 || ls.metadata != nil {
+		t.Errorf("headers should not be set by the kicked publisher, but got %d messages", len(ls.headers()))
+	}
+}
+
+func TestStreamsOfApplications(t *testing.T) {
+	c1, client1 := newConnectedTestConn()
+	defer client1.Close()
+	srv := c1.server
+	c2, client2 := newConnectedTestConnOf(srv)
+	defer client2.Close()
+	c1.app, c2.app = "live", "tv"
+	ns1 := &netStream{id: 1, conn: c1}
+	ns2 := &netStream{id: 1, conn: c2}
+
+	// The same stream name can be published in each application.
+	ls1, err := srv.publishStream("cam", ns1)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	ls2, err := srv.publishStream("cam", ns2)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if ls1 == ls2 || ls1.app != "live" || ls2.app != "tv" {
+		t.Fatalf("should be the streams of each application, but got %s and %s", ls1.app, ls2.app)
+	}
+	if srv.isPublished("radio", "cam") {
+		t.Errorf("should not be published in another application")
+	}
+
+	srv.unpublishStream("cam", ns1)
+	if srv.isPublished("live", "cam") || !srv.isPublished("tv", "cam") {
+		t.Errorf("should unpublish only the stream of the application")
+	}
+	srv.unpublishStream("cam", ns2)
+}
+
+// expectClosed waits until the server closes the connection of the client.
+func expectClosed(t *testing.T, c *pipeClient) {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-c.messages:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("connection should be closed")
+		}
+	}
+}
+
+func TestReleaseStream(t *testing.T) {
+	srv := &Server{}
+	c1, conn1 := newConnectedTestConnOf(srv)
+	defer conn1.Close()
+	c2, conn2 := newConnectedTestConnOf(srv)
+	defer conn2.Close()
+	c1.tcURL = "rtmp://localhost/live?key=secret"
+	c2.tcURL = "rtmp://localhost/live?key=secret"
+	pub1 := newPipeClient(t, conn1)
+	pub2 := newPipeClient(t, conn2)
+
+	id1 := pub1.createStream(1)
+	pub1.command(id1, "publish", 0, nil, "cam", "live")
+	pub1.expectStatus(id1, CodeNetStreamPublishStart)
+
+	// Another client cannot take over the stream of the live connection, even with the same tcUrl.
+	id2 := pub2.createStream(1)
+	pub2.command(0, "releaseStream", 2, nil, "cam")
+	pub2.command(id2, "publish", 0, nil, "cam", "live")
+	pub2.expectStatus(id2, CodeNetStreamPublishBadName)
+	pub1.send(MessageVideo, id1, 0, []byte{0x17, 0x01, 0x00, 0x00, 0x00})
+	pub1.createStream(3)
+
+	// The publisher on the unresponsive connection is released.
+	srv.PingInterval = time.Second
+	srv.PingTimeout = time.Second
+	c1.lastReadMu.Lock()
+	c1.lastRead = time.Now().Add(-3 * time.Second)
+	c1.lastReadMu.Unlock()
+	pub2.command(0, "releaseStream", 3, nil, "cam")
+	pub2.command(id2, "publish", 0, nil, "cam", "live")
+	pub2.expectStatus(id2, CodeNetStreamPublishStart)
+	expectClosed(t, pub1)
+}
+
+func TestAllowReleaseStream(t *testing.T) {
+	srv := &Server{}
+	srv.AllowReleaseStream = func(c *Conn, name string, publisher *Conn) bool {
+		return c.TcURL() == publisher.TcURL()
+	}
+	c1, conn1 := newConnectedTestConnOf(srv)
+	defer conn1.Close()
+	c2, conn2 := newConnectedTestConnOf(srv)
+	defer conn2.Close()
+	c3, conn3 := newConnectedTestConnOf(srv)
+	defer conn3.Close()
+	c1.tcURL = "rtmp://localhost/live?key=secret"
+	c2.tcURL = "rtmp://localhost/live?key=other"
+	c3.tcURL = "rtmp://localhost/live?key=secret"
+	pub1 := newPipeClient(t, conn1)
+	pub2 := newPipeClient(t, conn2)
+	pub3 := newPipeClient(t, conn3)
+
+	id1 := pub1.createStream(1)
+	pub1.command(id1, "publish", 0, nil, "cam", "live")
+	pub1.expectStatus(id1, CodeNetStreamPublishStart)
+
+	id2 := pub2.createStream(1)
+	pub2.command(0, "releaseStream", 2, nil, "cam")
+	pub2.command(id2, "publish", 0, nil, "cam", "live")
+	pub2.expectStatus(id2, CodeNetStreamPublishBadName)
+
+	id3 := pub3.createStream(1)
+	pub3.command(0, "releaseStream", 2, nil, "cam")
+	pub3.command(id3, "publish", 0, nil, "cam", "live")
+	pub3.expectStatus(id3, CodeNetStreamPublishStart)
+	expectClosed(t, pub1)
+}
+
+func TestGOPCache(t *testing.T) {
+	ls := &liveStream{gopCache: true}
+	for _, m := range []*message{
+		{typeID: MessageVideo, payload: testAVCSequenceHeader},
+		{typeID: MessageVideo, payload: []byte{0x27, 0x01, 0x00, 0x00, 0x00}},
+		{typeID: MessageVideo, payload: []byte{0x17, 0x01, 0x00, 0x00, 0x00}},
+		{typeID: MessageAudio, payload: []byte{0xaf, 0x01, 0x21}},
+		{typeID: MessageVideo, payload: []byte{0x27, 0x01, 0x00, 0x00, 0x00}},
+	} {
+		var err error
+		if m.typeID == MessageVideo {
+			err = ls.handleVideo(m)
+		} else {
+			err = ls.handleAudio(m)
+		}
+		if err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+	}
+	if len(ls.videoSequenceHeaders) == 0 {
+		t.Errorf("sequence header should be cached")
+	}
+	if ls.videoInfo == nil || ls.videoInfo.Width != 640 {
+		t.Errorf("video info should be decoded from the sequence header, but got %#v", ls.videoInfo)
+	}
+	if len(ls.gop) != 3 || ls.gop[0].payload[0] != 0x17 {
+		t.Errorf("GOP should start with the last keyframe, but got %d messages", len(ls.gop))
+	}
+}
+
+func TestMultitrackSequenceHeaders(t *testing.T) {
+	ls := &liveStream{}
+	both := &message{typeID: MessageAudio, payload: []byte{
+		0x95, 0x10, 'O', 'p', 'u', 's',
+		0x00, 0x00, 0x00, 0x01, 0xaa,
+		0x01, 0x00, 0x00, 0x01, 0xbb,
+	}}
+	track1 := &message{typeID: MessageAudio, payload: []byte{0x95, 0x00, 'O', 'p', 'u', 's', 0x01, 0xcc}}
+	for _, m := range []*message{both, track1} {
+		if err := ls.handleAudio(m); err != nil {
+			t.Fatalf("should be nil, but got %s", err)
+		}
+	}
+	headers := ls.audioSequenceHeaders.messages()
+	if len(headers) != 2 || headers[0] != both || headers[1] != track1 {
+		t.Errorf("should be the headers of both tracks and of track 1, but got %d messages", len(headers))
+	}
+}
+
+func TestRecordPublishingType(t *testing.T) {
+	dir := t.TempDir()
+	recordings := make(chan *Recording, 2)
+	srv := &Server{RecordDir: dir, OnRecording: func(r *Recording) {
+		recordings <- r
+	}}
+	_, conn := newConnectedTestConnOf(srv)
+	defer conn.Close()
+	client := newPipeClient(t, conn)
+
+	for i, publishType := range []string{"record", "append"} {
+		id := client.createStream(float64(i + 1))
+		client.command(id, "publish", 0, nil, "cam", publishType)
+		client.expectStatus(id, CodeNetStreamPublishStart)
+		client.expectStatus(id, CodeNetStreamRecordStart)
+		client.send(MessageVideo, id, 1000, []byte{0x17, 0x01, 0x00, 0x00, 0x00})
+		client.send(MessageVideo, id, 1040, []byte{0x27, 0x01, 0x00, 0x00, 0x00})
+		client.command(id, "closeStream", 0, nil)
+		client.expectStatus(id, CodeNetStreamRecordStop)
+		client.expectStatus(id, CodeNetStreamUnpublishSuccess)
+
+		r := <-recordings
+		if r.Path != filepath.Join(dir, "cam.flv") || r.Duration.Milliseconds() != int64(40*(i+1)) {
+			t.Errorf("should be cam.flv of %d ms, but got %s of %s", 40*(i+1), r.Path, r.Duration)
+		}
+	}
+
+	// The appended file is finalized again with the keyframes of both recordings.
+	f, err := os.Open(filepath.Join(dir, "cam.flv"))
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	defer f.Close()
+	info, _ := f.Stat()
+	tags, _, err := readFLVTags(f, info.Size())
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if len(tags) != 5 || tags[0].tagType != flvTagScript {
+		t.Fatalf("should be onMetaData and 4 video tags, but got %d tags", len(tags))
+	}
+	data, _ := tags[0].readData(f)
+	md, err := ReadMetadata(data)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if keyframes, _ := md.Raw["keyframes"].(amf.Object); len(keyframes["times"].([]interface{})) != 2 {
+		t.Errorf("should have 2 keyframes, but got %#v", md.Raw["keyframes"])
+	}
+
+	// The recording can be stopped with StopRecording.
+	id := client.createStream(3)
+	client.command(id, "publish", 0, nil, "cam", "record")
+	client.expectStatus(id, CodeNetStreamPublishStart)
+	client.expectStatus(id, CodeNetStreamRecordStart)
+	client.send(MessageVideo, id, 0, []byte{0x17, 0x01, 0x00, 0x00, 0x00})
+	// The result of createStream makes sure that the video is recorded.
+	client.createStream(4)
+	if err = srv.StopRecording("", "cam"); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	client.expectStatus(id, CodeNetStreamRecordStop)
+	<-recordings
+}
@@ -0,0 +1,169 @@
+package rtmp
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/c-bata/rtmp/aac"
+	"github.com/c-bata/rtmp/avc"
+	"github.com/c-bata/rtmp/hevc"
+)
+
+var errNoSPS = errors.New("no SPS in the sequence header")
+
+// A VideoInfo is the properties of the video of a stream, which are decoded from the sequence header.
+// Only Codec is present for the codecs which are not parsed.
+type VideoInfo struct {
+	Codec string
+	// CodecString is the codecs parameter of RFC 6381, like "avc1.64001F" and "hvc1.1.6.L93.B0".
+	CodecString string
+	Profile     string
+	Level       float64
+	Width       int
+	Height      int
+	// FrameRate is 0 if the sequence header does not have the timing information.
+	FrameRate float64
+	BitDepth  int
+	// ChromaFormat is chroma_format_idc, which is 0 for monochrome, 1 for 4:2:0, 2 for 4:2:2 and 3 for 4:4:4.
+	ChromaFormat int
+	// Config is the decoder configuration record, which is the payload of the avcC or hvcC box.
+	Config []byte
+}
+
+// An AudioInfo is the properties of the audio of a stream, which are decoded from the sequence header
+// or from the header of the audio packets.
+type AudioInfo struct {
+	Codec string
+	// Profile is present only for AAC, like "LC" and "HE-AAC".
+	Profile string
+	// SampleRate and Channels are 0 if they are unknown.
+	SampleRate int
+	Channels   int
+}
+
+// A StreamInfo is the properties of the codecs of a live stream.
+type StreamInfo struct {
+	// Audio and Video are nil until they are published.
+	Audio *AudioInfo
+	Video *VideoInfo
+}
+
+// readAudioInfo decodes the sequence header, or the header of the packet for formats without sequence headers.
+func readAudioInfo(p *AudioPacket) (*AudioInfo, error) {
+	var config []byte
+	switch {
+	case p.SoundFormat == SoundFormatExHeader:
+		if p.FourCC != FourCCAAC {
+			return &AudioInfo{Codec: p.FourCC.String()}, nil
+		}
+		config = p.Data
+	case p.SoundFormat == SoundFormatAAC:
+		config = p.Data
+	default:
+		return &AudioInfo{
+			Codec:      p.SoundFormat.String(),
+			SampleRate: p.SampleRate(),
+			Channels:   p.Channels(),
+		}, nil
+	}
+
+	asc, err := aac.ParseAudioSpecificConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &AudioInfo{
+		Codec:      "AAC",
+		Profile:    asc.ProfileName(),
+		SampleRate: asc.OutputSampleRate(),
+		Channels:   asc.Channels(),
+	}, nil
+}
+
+// readVideoInfo decodes the sequence header. Codecs which are not parsed have only Codec.
+func readVideoInfo(p *VideoPacket) (*VideoInfo, error) {
+	switch {
+	case p.IsExHeader && p.FourCC == FourCCHEVC:
+		return readHEVCInfo(p.Data)
+	case p.IsExHeader:
+		return &VideoInfo{Codec: p.FourCC.String()}, nil
+	case p.CodecID == VideoCodecAVC:
+		return readAVCInfo(p.Data)
+	}
+	return &VideoInfo{Codec: p.CodecID.String()}, nil
+}
+
+func readAVCInfo(config []byte) (*VideoInfo, error) {
+	record, err := avc.ParseDecoderConfigurationRecord(config)
+	if err != nil {
+		return nil, err
+	}
+	if len(record.SPS) == 0 {
+		return nil, errNoSPS
+	}
+	sps, err := avc.ParseSPS(record.SPS[0])
+	if err != nil {
+		return nil, err
+	}
+	return &VideoInfo{
+		Codec:        "AVC",
+		CodecString:  fmt.Sprintf("avc1.%02X%02X%02X", sps.ProfileIDC, sps.ConstraintFlags, sps.LevelIDC),
+		Profile:      sps.ProfileName(),
+		Level:        sps.Level(),
+		Width:        sps.Width,
+		Height:       sps.Height,
+		FrameRate:    sps.FrameRate(),
+		BitDepth:     int(sps.BitDepthLuma),
+		ChromaFormat: int(sps.ChromaFormatIDC),
+		Config:       config,
+	}, nil
+}
+
+func readHEVCInfo(config []byte) (*VideoInfo, error) {
+	record, err := hevc.ParseDecoderConfigurationRecord(config)
+	if err != nil {
+		return nil, err
+	}
+	nalUnits := record.NALUnits(hevc.NALUnitTypeSPS)
+	if len(nalUnits) == 0 {
+		return nil, errNoSPS
+	}
+	sps, err := hevc.ParseSPS(nalUnits[0])
+	if err != nil {
+		return nil, err
+	}
+	info := &VideoInfo{
+		Codec:        "HEVC",
+		CodecString:  sps.ProfileTierLevel.CodecString(),
+		Profile:      sps.ProfileTierLevel.ProfileName(),
+		Level:        sps.ProfileTierLevel.Level(),
+		Width:        sps.Width,
+		Height:       sps.Height,
+		BitDepth:     int(sps.BitDepthLuma),
+		ChromaFormat: int(sps.ChromaFormatIDC),
+		Config:       config,
+	}
+	// The timing information is in the VPS. The VPS is optional, since it is not needed for the properties.
+	if nalUnits = record.NALUnits(hevc.NALUnitTypeVPS); len(nalUnits) > 0 {
+		if vps, err := hevc.ParseVPS(nalUnits[0]); err == nil {
+			info.FrameRate = vps.FrameRate()
+		}
+	}
+	return info, nil
+}
+
+// StreamInfo returns the properties of the codecs of the live stream of the application.
+func (srv *Server) StreamInfo(app, name string) (*StreamInfo, bool) {
+	srv.mu.Lock()
+	ls, ok := srv.streams[streamKey{app: app, name: name}]
+	srv.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.publisher == nil {
+		return nil, false
+	}
+	return &StreamInfo{Audio: ls.audioInfo, Video: ls.videoInfo}, true
+}
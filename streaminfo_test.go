@@ -0,0 +1,102 @@
+package rtmp
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testAVCSequenceHeader is the payload of the AVC sequence header of 640x480 Baseline 3.0.
+var testAVCSequenceHeader = []byte{
+	0x17, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x42, 0x00, 0x1e, 0xff, 0xe1,
+	0x00, 0x09, 0x67, 0x42, 0x00, 0x1e, 0x95, 0xa8, 0x28, 0x0f, 0x64,
+	0x01, 0x00, 0x04, 0x68, 0xce, 0x3c, 0x80,
+}
+
+func TestReadVideoInfo(t *testing.T) {
+	p, err := ReadVideoPacket(0, testAVCSequenceHeader)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	info, err := readVideoInfo(p)
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	want := &VideoInfo{
+		Codec:        "AVC",
+		CodecString:  "avc1.42001E",
+		Profile:      "Baseline",
+		Level:        3,
+		Width:        640,
+		Height:       480,
+		BitDepth:     8,
+		ChromaFormat: 1,
+		Config:       testAVCSequenceHeader[5:],
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("should be %#v, but got %#v", want, info)
+	}
+
+	// The HEVC sequence header of 1280x720 Main 4.0.
+	hvcC := []byte{
+		0x01, 0x01, 0x60, 0x00, 0x00, 0x00, 0x90, 0x00, 0x00, 0x00, 0x00, 0x00, 0x78, 0xf0, 0x00, 0xfc,
+		0xfd, 0xf8, 0xf8, 0x00, 0x00, 0x03, 0x01, 0xa1, 0x00, 0x01, 0x00, 0x18, 0x42, 0x01, 0x01, 0x01,
+		0x60, 0x00, 0x00, 0x03, 0x00, 0x90, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00, 0x78, 0xa0, 0x02,
+		0x80, 0x80, 0x2d, 0x17,
+	}
+	p, err = ReadVideoPacket(0, append([]byte{0x90, 'h', 'v', 'c', '1'}, hvcC...))
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if info, err = readVideoInfo(p); err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	want = &VideoInfo{
+		Codec:        "HEVC",
+		CodecString:  "hvc1.1.6.L120.90",
+		Profile:      "Main",
+		Level:        4,
+		Width:        1280,
+		Height:       720,
+		BitDepth:     8,
+		ChromaFormat: 1,
+		Config:       hvcC,
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("should be %#v, but got %#v", want, info)
+	}
+
+	p, err = ReadVideoPacket(0, []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01, 0x42, 0x00, 0x1e, 0xff, 0xe0, 0x00})
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if _, err = readVideoInfo(p); err != errNoSPS {
+		t.Errorf("should be errNoSPS, but got %v", err)
+	}
+}
+
+func TestReadAudioInfo(t *testing.T) {
+	for _, tt := range []struct {
+		payload []byte
+		want    AudioInfo
+	}{
+		{[]byte{0xaf, 0x00, 0x12, 0x10}, AudioInfo{Codec: "AAC", Profile: "LC", SampleRate: 44100, Channels: 2}},
+		{[]byte{0x90, 'm', 'p', '4', 'a', 0x2b, 0x11, 0x88, 0x00}, AudioInfo{Codec: "AAC", Profile: "HE-AAC", SampleRate: 48000, Channels: 2}},
+		{[]byte{0x90, 'O', 'p', 'u', 's', 0x4f}, AudioInfo{Codec: "Opus"}},
+		{[]byte{0x2a, 0xff}, AudioInfo{Codec: "MP3", SampleRate: 22050, Channels: 1}},
+	} {
+		p, err := ReadAudioPacket(tt.payload)
+		if err != nil {
+			t.Errorf("should be nil, but got %s", err)
+			continue
+		}
+		info, err := readAudioInfo(p)
+		if err != nil {
+			t.Errorf("should be nil, but got %s", err)
+			continue
+		}
+		if *info != tt.want {
+			t.Errorf("should be %#v, but got %#v", tt.want, *info)
+		}
+	}
+}
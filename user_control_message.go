@@ -1,6 +1,79 @@
 package rtmp
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"errors"
+)
+
+type UserControlEventType uint16
+
+const (
+	UserControlStreamBegin      UserControlEventType = 0
+	UserControlStreamEOF                             = 1
+	UserControlStreamDry                             = 2
+	UserControlSetBufferLength                       = 3
+	UserControlStreamIsRecorded                      = 4
+	UserControlPingRequest                           = 6
+	UserControlPingResponse                          = 7
+)
+
+var errInvalidUserControlMessage = errors.New("invalid user control message")
+
+// A UserControlEvent is the event of a User Control Message.
+//
+//	+------------------------------+-------------------------
+//	|     Event Type (16 bits)     | Event Data
+//	+------------------------------+-------------------------
+type UserControlEvent struct {
+	Type UserControlEventType
+	// StreamID is the stream of StreamBegin, StreamEOF, StreamDry, SetBufferLength and StreamIsRecorded events.
+	StreamID uint32
+	// BufferLength is the buffer length of SetBufferLength events in milliseconds.
+	BufferLength uint32
+	// Timestamp is the time of PingRequest and PingResponse events.
+	Timestamp uint32
+}
+
+// ReadUserControlEvent parses the payload of a User Control Message.
+func ReadUserControlEvent(payload []byte) (*UserControlEvent, error) {
+	if len(payload) < 6 {
+		return nil, errInvalidUserControlMessage
+	}
+	e := &UserControlEvent{Type: UserControlEventType(binary.BigEndian.Uint16(payload[:2]))}
+	data := binary.BigEndian.Uint32(payload[2:6])
+	switch e.Type {
+	case UserControlStreamBegin, UserControlStreamEOF, UserControlStreamDry, UserControlStreamIsRecorded:
+		e.StreamID = data
+	case UserControlSetBufferLength:
+		if len(payload) < 10 {
+			return nil, errInvalidUserControlMessage
+		}
+		e.StreamID = data
+		e.BufferLength = binary.BigEndian.Uint32(payload[6:10])
+	case UserControlPingRequest, UserControlPingResponse:
+		e.Timestamp = data
+	default:
+		return nil, errInvalidUserControlMessage
+	}
+	return e, nil
+}
+
+// Bytes encodes the event as the payload of a User Control Message.
+func (e *UserControlEvent) Bytes() []byte {
+	x := make([]byte, 6, 10)
+	binary.BigEndian.PutUint16(x[:2], uint16(e.Type))
+	switch e.Type {
+	case UserControlSetBufferLength:
+		binary.BigEndian.PutUint32(x[2:6], e.StreamID)
+		x = x[:10]
+		binary.BigEndian.PutUint32(x[6:10], e.BufferLength)
+	case UserControlPingRequest, UserControlPingResponse:
+		binary.BigEndian.PutUint32(x[2:6], e.Timestamp)
+	default:
+		binary.BigEndian.PutUint32(x[2:6], e.StreamID)
+	}
+	return x
+}
 
 func generateUserControlMessageHeader(messageLength uint32) *ChunkHeader {
 	return &ChunkHeader{
@@ -15,20 +88,40 @@ func generateUserControlMessageHeader(messageLength uint32) *ChunkHeader {
 	}
 }
 
-func GenerateUserStreamBegin(streamID uint32) ([]byte, error) {
-	var (
-		eventType  uint16 = 0
-		messageLen uint32 = 6
-	)
-
-	ch := generateUserControlMessageHeader(messageLen)
+func GenerateUserControlMessage(e *UserControlEvent) ([]byte, error) {
+	y := e.Bytes()
+	ch := generateUserControlMessageHeader(uint32(len(y)))
 	x, err := genChunkHeader(ch)
 	if err != nil {
 		return []byte{}, err
 	}
-
-	y := make([]byte, messageLen)
-	binary.BigEndian.PutUint16(y[:2], eventType)
-	binary.BigEndian.PutUint32(y[2:], streamID)
 	return append(x, y...), nil
 }
+
+func GenerateUserStreamBegin(streamID uint32) ([]byte, error) {
+	return GenerateUserControlMessage(&UserControlEvent{Type: UserControlStreamBegin, StreamID: streamID})
+}
+
+func GenerateUserStreamEOF(streamID uint32) ([]byte, error) {
+	return GenerateUserControlMessage(&UserControlEvent{Type: UserControlStreamEOF, StreamID: streamID})
+}
+
+func GenerateUserStreamDry(streamID uint32) ([]byte, error) {
+	return GenerateUserControlMessage(&UserControlEvent{Type: UserControlStreamDry, StreamID: streamID})
+}
+
+func GenerateUserSetBufferLength(streamID, bufferLength uint32) ([]byte, error) {
+	return GenerateUserControlMessage(&UserControlEvent{Type: UserControlSetBufferLength, StreamID: streamID, BufferLength: bufferLength})
+}
+
+func GenerateUserStreamIsRecorded(streamID uint32) ([]byte, error) {
+	return GenerateUserControlMessage(&UserControlEvent{Type: UserControlStreamIsRecorded, StreamID: streamID})
+}
+
+func GenerateUserPingRequest(timestamp uint32) ([]byte, error) {
+	return GenerateUserControlMessage(&UserControlEvent{Type: UserControlPingRequest, Timestamp: timestamp})
+}
+
+func GenerateUserPingResponse(timestamp uint32) ([]byte, error) {
+	return GenerateUserControlMessage(&UserControlEvent{Type: UserControlPingResponse, Timestamp: timestamp})
+}
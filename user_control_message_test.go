@@ -17,3 +17,24 @@ func TestGenerateUserStreamBegin(t *testing.T) {
 		t.Errorf("should be %#v, but got %#v", expected, actual)
 	}
 }
+
+func TestReadUserControlEvent(t *testing.T) {
+	for _, e := range []*UserControlEvent{
+		{Type: UserControlStreamEOF, StreamID: 1},
+		{Type: UserControlSetBufferLength, StreamID: 1, BufferLength: 3000},
+		{Type: UserControlPingRequest, Timestamp: 0x12345678},
+	} {
+		actual, err := ReadUserControlEvent(e.Bytes())
+		if err != nil {
+			t.Errorf("should be nil, but got %s", err)
+			continue
+		}
+		if *actual != *e {
+			t.Errorf("should be %#v, but got %#v", e, actual)
+		}
+	}
+
+	if _, err := ReadUserControlEvent([]byte{0x00, 0x03, 0x00, 0x00, 0x00, 0x01}); err == nil {
+		t.Errorf("should be error for SetBufferLength without buffer length")
+	}
+}
@@ -0,0 +1,253 @@
+package rtmp
+
+import (
+	"errors"
+	"fmt"
+)
+
+type VideoFrameType uint8
+
+const (
+	VideoFrameTypeKeyframe              VideoFrameType = 1
+	VideoFrameTypeInterFrame                           = 2
+	VideoFrameTypeDisposableInterFrame                 = 3
+	VideoFrameTypeGeneratedKeyframe                    = 4
+	VideoFrameTypeVideoInfoCommandFrame                = 5
+)
+
+type VideoCodecID uint8
+
+const (
+	VideoCodecSorensonH263        VideoCodecID = 2
+	VideoCodecScreenVideo                      = 3
+	VideoCodecOn2VP6                           = 4
+	VideoCodecOn2VP6WithAlpha                  = 5
+	VideoCodecScreenVideoVersion2              = 6
+	VideoCodecAVC                              = 7
+)
+
+var videoCodecNames = map[VideoCodecID]string{
+	VideoCodecSorensonH263:        "Sorenson H.263",
+	VideoCodecScreenVideo:         "Screen video",
+	VideoCodecOn2VP6:              "On2 VP6",
+	VideoCodecOn2VP6WithAlpha:     "On2 VP6 with alpha channel",
+	VideoCodecScreenVideoVersion2: "Screen video version 2",
+	VideoCodecAVC:                 "AVC",
+}
+
+func (id VideoCodecID) String() string {
+	if name, ok := videoCodecNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("VideoCodecID(%d)", uint8(id))
+}
+
+type AVCPacketType uint8
+
+const (
+	AVCPacketTypeSequenceHeader AVCPacketType = 0
+	AVCPacketTypeNALU                         = 1
+	AVCPacketTypeEndOfSequence                = 2
+)
+
+// A VideoPacketType is the type of the video packet with the Enhanced RTMP extended header.
+type VideoPacketType uint8
+
+const (
+	VideoPacketTypeSequenceStart        VideoPacketType = 0
+	VideoPacketTypeCodedFrames                          = 1
+	VideoPacketTypeSequenceEnd                          = 2
+	VideoPacketTypeCodedFramesX                         = 3
+	VideoPacketTypeMetadata                             = 4
+	VideoPacketTypeMPEG2TSSequenceStart                 = 5
+	VideoPacketTypeMultitrack                           = 6
+	VideoPacketTypeModEx                                = 7
+)
+
+var errInvalidVideoTag = errors.New("invalid video tag")
+
+// A VideoPacket is the payload of a video message, which is an FLV video tag without the tag header.
+//
+//	+-----------+----------+---------------+-----------------+---------------
+//	| FrameType | CodecID  | AVCPacketType | CompositionTime | Data
+//	| (4 bits)  | (4 bits) | (8 bits, AVC) | (24 bits, AVC)  |
+//	+-----------+----------+---------------+-----------------+---------------
+//
+// With the Enhanced RTMP extended header, the codec is identified by a FourCC instead.
+//
+//	+------------+-----------+------------+----------+-------------------------+---------------
+//	| IsExHeader | FrameType | PacketType | FourCC   | CompositionTime         | Data
+//	| (1 bit)    | (3 bits)  | (4 bits)   | (32 bits)| (24 bits, CodedFrames)  |
+//	+------------+-----------+------------+----------+-------------------------+---------------
+type VideoPacket struct {
+	FrameType VideoFrameType
+	// CodecID is 0 if the packet has the extended header.
+	CodecID VideoCodecID
+	// AVCPacketType is present only if CodecID is AVC.
+	AVCPacketType AVCPacketType
+
+	// IsExHeader reports whether the packet has the Enhanced RTMP extended header,
+	// which has PacketType and FourCC.
+	IsExHeader bool
+	PacketType VideoPacketType
+	FourCC     FourCC
+	// VideoCommand is present if FrameType is VideoInfoCommandFrame with the extended header.
+	VideoCommand uint8
+
+	// IsMultitrack reports whether the packet has multiple tracks. PacketType is the type of
+	// the tracks, and FourCC is 0 if the tracks have different codecs.
+	IsMultitrack   bool
+	MultitrackType MultitrackType
+	// Tracks are the tracks of the multitrack packet, and TrackID is the ID of each track.
+	Tracks  []*VideoPacket
+	TrackID uint8
+
+	// CompositionTime is present for AVC and for CodedFrames of HEVC.
+	// CompositionTime is the offset of the presentation time from the decoding time in milliseconds.
+	CompositionTime int32
+	// DTS is the decoding time, which is the timestamp of the message, and PTS is the presentation time.
+	DTS uint32
+	PTS uint32
+	// Data is the decoder configuration record for sequence headers, otherwise the video frame.
+	Data []byte
+}
+
+// ReadVideoPacket parses the payload of a video message which has the timestamp.
+func ReadVideoPacket(timestamp uint32, payload []byte) (*VideoPacket, error) {
+	if len(payload) < 1 {
+		return nil, errInvalidVideoTag
+	}
+	if payload[0]&0x80 != 0 {
+		return readExVideoPacket(timestamp, payload)
+	}
+	p := &VideoPacket{
+		FrameType: VideoFrameType(payload[0] >> 4),
+		CodecID:   VideoCodecID(payload[0] & 0x0f),
+		DTS:       timestamp,
+		PTS:       timestamp,
+		Data:      payload[1:],
+	}
+	if p.CodecID == VideoCodecAVC && p.FrameType != VideoFrameTypeVideoInfoCommandFrame {
+		if len(payload) < 5 {
+			return nil, errInvalidVideoTag
+		}
+		p.AVCPacketType = AVCPacketType(payload[1])
+		// CompositionTime is a signed 24-bit integer.
+		p.CompositionTime = int32(uint32(payload[2])<<24|uint32(payload[3])<<16|uint32(payload[4])<<8) >> 8
+		p.PTS = uint32(int64(timestamp) + int64(p.CompositionTime))
+		p.Data = payload[5:]
+	}
+	return p, nil
+}
+
+func readExVideoPacket(timestamp uint32, payload []byte) (*VideoPacket, error) {
+	p := &VideoPacket{
+		IsExHeader: true,
+		FrameType:  VideoFrameType(payload[0] >> 4 & 0x07),
+		PacketType: VideoPacketType(payload[0] & 0x0f),
+		DTS:        timestamp,
+		PTS:        timestamp,
+	}
+	data := payload[1:]
+	if p.PacketType == VideoPacketTypeModEx {
+		packetType, rest, err := skipModEx(data)
+		if err != nil {
+			return nil, errInvalidVideoTag
+		}
+		p.PacketType, data = VideoPacketType(packetType), rest
+	}
+	if p.PacketType != VideoPacketTypeMultitrack {
+		fourCC, rest, err := readFourCC(data)
+		if err != nil {
+			return nil, errInvalidVideoTag
+		}
+		p.FourCC = fourCC
+		return p, p.readBody(rest)
+	}
+
+	mt, err := readMultitrack(data)
+	if err != nil {
+		return nil, errInvalidVideoTag
+	}
+	p.IsMultitrack = true
+	p.MultitrackType = mt.multitrackType
+	p.PacketType = VideoPacketType(mt.packetType)
+	p.FourCC = mt.fourCC
+	for _, t := range mt.tracks {
+		tp := &VideoPacket{
+			IsExHeader: true,
+			FrameType:  p.FrameType,
+			PacketType: p.PacketType,
+			FourCC:     t.fourCC,
+			TrackID:    t.id,
+			DTS:        timestamp,
+			PTS:        timestamp,
+		}
+		if err = tp.readBody(t.body); err != nil {
+			return nil, err
+		}
+		p.Tracks = append(p.Tracks, tp)
+	}
+	return p, nil
+}
+
+// readBody reads the data which follows the FourCC of the packet with the extended header.
+func (p *VideoPacket) readBody(data []byte) error {
+	if p.FrameType == VideoFrameTypeVideoInfoCommandFrame && p.PacketType != VideoPacketTypeMetadata {
+		if len(data) < 1 {
+			return errInvalidVideoTag
+		}
+		p.VideoCommand = data[0]
+		return nil
+	}
+	if p.PacketType == VideoPacketTypeCodedFrames && p.FourCC == FourCCHEVC {
+		if len(data) < 3 {
+			return errInvalidVideoTag
+		}
+		p.CompositionTime = int32(uint32(data[0])<<24|uint32(data[1])<<16|uint32(data[2])<<8) >> 8
+		p.PTS = uint32(int64(p.DTS) + int64(p.CompositionTime))
+		data = data[3:]
+	}
+	p.Data = data
+	return nil
+}
+
+// IsKeyframe reports whether the packet is a keyframe, from which players can start decoding.
+func (p *VideoPacket) IsKeyframe() bool {
+	return p.FrameType == VideoFrameTypeKeyframe || p.FrameType == VideoFrameTypeGeneratedKeyframe
+}
+
+// IsSequenceHeader reports whether the packet is a sequence header, which carries the decoder
+// configuration record, like AVCDecoderConfigurationRecord or HEVCDecoderConfigurationRecord.
+func (p *VideoPacket) IsSequenceHeader() bool {
+	if p.IsExHeader {
+		return p.PacketType == VideoPacketTypeSequenceStart || p.PacketType == VideoPacketTypeMPEG2TSSequenceStart
+	}
+	return p.CodecID == VideoCodecAVC && p.AVCPacketType == AVCPacketTypeSequenceHeader
+}
+
+// trackIDs returns the IDs of the tracks of the packet. Packets without multiple tracks are for the default track.
+func (p *VideoPacket) trackIDs() []uint8 {
+	if !p.IsMultitrack {
+		return []uint8{defaultTrack}
+	}
+	ids := make([]uint8, 0, len(p.Tracks))
+	for _, t := range p.Tracks {
+		ids = append(ids, t.TrackID)
+	}
+	return ids
+}
+
+// track returns the packet of the track, which is the packet itself if it does not have multiple tracks.
+// It returns nil if the multitrack packet does not have the track.
+func (p *VideoPacket) track(id uint8) *VideoPacket {
+	if !p.IsMultitrack {
+		return p
+	}
+	for _, t := range p.Tracks {
+		if t.TrackID == id {
+			return t
+		}
+	}
+	return nil
+}
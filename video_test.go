@@ -0,0 +1,107 @@
+package rtmp
+
+import "testing"
+
+func TestReadVideoPacket(t *testing.T) {
+	p, err := ReadVideoPacket(1000, []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01, 0x64})
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if !p.IsKeyframe() || !p.IsSequenceHeader() || p.CodecID != VideoCodecAVC {
+		t.Errorf("should be AVC sequence header, but got %#v", p)
+	}
+
+	for _, tt := range []struct {
+		payload         []byte
+		compositionTime int32
+		pts             uint32
+	}{
+		{[]byte{0x27, 0x01, 0x00, 0x00, 0x50, 0xff}, 80, 1080},
+		{[]byte{0x27, 0x01, 0xff, 0xff, 0xd8, 0xff}, -40, 960},
+	} {
+		p, err := ReadVideoPacket(1000, tt.payload)
+		if err != nil {
+			t.Errorf("should be nil, but got %s", err)
+			continue
+		}
+		if p.IsKeyframe() || p.IsSequenceHeader() {
+			t.Errorf("should be an inter frame, but got %#v", p)
+		}
+		if p.CompositionTime != tt.compositionTime || p.DTS != 1000 || p.PTS != tt.pts {
+			t.Errorf("should be CompositionTime %d (DTS: 1000, PTS: %d), but got %d (DTS: %d, PTS: %d)", tt.compositionTime, tt.pts, p.CompositionTime, p.DTS, p.PTS)
+		}
+	}
+
+	p, err = ReadVideoPacket(0, []byte{0x22, 0xff})
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if p.CodecID != VideoCodecSorensonH263 || p.IsSequenceHeader() || len(p.Data) != 1 {
+		t.Errorf("should be Sorenson H.263 frame, but got %#v", p)
+	}
+
+	if _, err = ReadVideoPacket(0, []byte{0x17, 0x01}); err == nil {
+		t.Errorf("should be error for AVC without CompositionTime")
+	}
+}
+
+func TestReadExVideoPacket(t *testing.T) {
+	for _, tt := range []struct {
+		payload        []byte
+		fourCC         FourCC
+		packetType     VideoPacketType
+		sequenceHeader bool
+		pts            uint32
+		data           int
+	}{
+		// SequenceStart of HEVC
+		{[]byte{0x90, 'h', 'v', 'c', '1', 0x01, 0x02}, FourCCHEVC, VideoPacketTypeSequenceStart, true, 1000, 2},
+		// CodedFrames of HEVC has CompositionTime
+		{[]byte{0x91, 'h', 'v', 'c', '1', 0x00, 0x00, 0x50, 0xff}, FourCCHEVC, VideoPacketTypeCodedFrames, false, 1080, 1},
+		// CodedFramesX has no CompositionTime
+		{[]byte{0x93, 'h', 'v', 'c', '1', 0xff}, FourCCHEVC, VideoPacketTypeCodedFramesX, false, 1000, 1},
+		// CodedFrames of AV1 has no CompositionTime
+		{[]byte{0x91, 'a', 'v', '0', '1', 0xff, 0xff}, FourCCAV1, VideoPacketTypeCodedFrames, false, 1000, 2},
+		{[]byte{0x95, 'a', 'v', '0', '1', 0x01}, FourCCAV1, VideoPacketTypeMPEG2TSSequenceStart, true, 1000, 1},
+		// ModEx with a 3-byte modifier, followed by SequenceStart
+		{[]byte{0x97, 0x02, 0x00, 0x00, 0x00, 0x00, 'v', 'p', '0', '9', 0x01}, FourCCVP9, VideoPacketTypeSequenceStart, true, 1000, 1},
+	} {
+		p, err := ReadVideoPacket(1000, tt.payload)
+		if err != nil {
+			t.Errorf("should be nil, but got %s", err)
+			continue
+		}
+		if !p.IsExHeader || !p.IsKeyframe() || p.FourCC != tt.fourCC || p.PacketType != tt.packetType {
+			t.Errorf("should be %s keyframe of PacketType %d, but got %#v", tt.fourCC, tt.packetType, p)
+		}
+		if p.IsSequenceHeader() != tt.sequenceHeader || p.PTS != tt.pts || len(p.Data) != tt.data {
+			t.Errorf("should be sequence header %t (PTS: %d, %d bytes), but got %#v", tt.sequenceHeader, tt.pts, tt.data, p)
+		}
+	}
+
+	if _, err := ReadVideoPacket(0, []byte{0x91, 'h', 'v', 'c'}); err == nil {
+		t.Errorf("should be error for the truncated FourCC")
+	}
+	if _, err := ReadVideoPacket(0, []byte{0x91, 'h', 'v', 'c', '1', 0x00}); err == nil {
+		t.Errorf("should be error for HEVC CodedFrames without CompositionTime")
+	}
+}
+
+func TestReadMultitrackVideoPacket(t *testing.T) {
+	p, err := ReadVideoPacket(1000, []byte{
+		0x96, 0x11, 'h', 'v', 'c', '1',
+		0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x28, 0xff,
+		0x01, 0x00, 0x00, 0x04, 0x00, 0x00, 0x50, 0xff,
+	})
+	if err != nil {
+		t.Fatalf("should be nil, but got %s", err)
+	}
+	if !p.IsMultitrack || !p.IsKeyframe() || p.FourCC != FourCCHEVC || p.PacketType != VideoPacketTypeCodedFrames || len(p.Tracks) != 2 {
+		t.Fatalf("should be multitrack HEVC keyframe with 2 tracks, but got %#v", p)
+	}
+	for i, pts := range []uint32{1040, 1080} {
+		if track := p.Tracks[i]; track.TrackID != uint8(i) || track.PTS != pts || len(track.Data) != 1 {
+			t.Errorf("should be track %d (PTS: %d), but got %#v", i, pts, track)
+		}
+	}
+}